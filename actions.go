@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+// jobTimeout bounds the time a job action may take unless it sets its own,
+// see timedJobAction.
+const jobTimeout = time.Minute
+
+// jobAction performs the work of one job type. Compensate reverses the
+// effect of a successful Execute, e.g. unmuting a channel that was muted.
+type jobAction interface {
+	Execute(ctx context.Context, job db.Job) error
+	Compensate(ctx context.Context, job db.Job) error
+}
+
+// timedJobAction is implemented by job actions that may take longer than
+// jobTimeout.
+type timedJobAction interface {
+	Timeout() time.Duration
+}
+
+// actionTimeout returns the time an action may take.
+func actionTimeout(action jobAction) time.Duration {
+	if timed, ok := action.(timedJobAction); ok {
+		return timed.Timeout()
+	}
+	return jobTimeout
+}
+
+// jobActions holds the action of every known Job.TaskType; executeJob
+// dispatches through it.
+var jobActions = make(map[string]jobAction)
+
+// registerJobAction makes a job type executable. It is meant to be called
+// from init functions.
+func registerJobAction(taskType string, action jobAction) {
+	if _, exists := jobActions[taskType]; exists {
+		panic("job action registered twice: " + taskType)
+	}
+	jobActions[taskType] = action
+}
+
+func init() {
+	registerJobAction("MUTE", muteAction{})
+	registerJobAction("UNMUTE", unmuteAction{})
+}
+
+// checkTaskTypes returns an error naming the job types without a
+// registered action.
+func checkTaskTypes(taskTypes ...string) error {
+	var unknown []string
+	for _, taskType := range taskTypes {
+		if _, ok := jobActions[taskType]; !ok {
+			unknown = append(unknown, taskType)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unsupported job types: %s", strings.Join(unknown, ", "))
+}
+
+// validateActions checks the job types a timer request asks its windows to
+// run: they must be registered, and a type starting a window needs the one
+// ending it and vice versa. An empty list runs every type.
+func validateActions(actions []string) []fieldError {
+	var fields []fieldError
+	for i, taskType := range actions {
+		field := "actions[" + strconv.Itoa(i) + "]"
+		switch {
+		case checkTaskTypes(taskType) != nil:
+			fields = append(fields, fieldError{Field: field, Message: "is not a supported job type"})
+		case !slices.Contains(timerTaskTypes, taskType):
+			fields = append(fields, fieldError{Field: field, Message: "is not a job type of timer windows"})
+		case slices.Index(actions, taskType) != i:
+			fields = append(fields, fieldError{Field: field, Message: "is listed twice"})
+		}
+	}
+	for end, start := range windowEndTasks {
+		if slices.Contains(actions, start) != slices.Contains(actions, end) {
+			fields = append(fields, fieldError{Field: "actions", Message: start + " and " + end + " must be listed together"})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field+fields[i].Message < fields[j].Field+fields[j].Message })
+	return fields
+}
+
+// timerTaskTypes are the job types timer windows can run.
+var timerTaskTypes = windowTaskTypes(db.Timing{Status: &db.TimerStatus{}, Digest: true})
+
+// timerRuns reports whether a timer's windows run a job type, provided its
+// settings produce it.
+func timerRuns(timer db.Timing, taskType string) bool {
+	return len(timer.Actions) == 0 || slices.Contains(timer.Actions, taskType)
+}
+
+// windowTaskTypes lists the job types a timer's settings produce for each
+// window.
+func windowTaskTypes(timer db.Timing) []string {
+	taskTypes := []string{"MUTE", "UNMUTE"}
+	if timer.Status != nil {
+		taskTypes = append(taskTypes, "SET_STATUS", "RESTORE_STATUS")
+	}
+	if timer.Digest {
+		taskTypes = append(taskTypes, "DIGEST")
+	}
+	return taskTypes
+}
+
+type muteAction struct{}
+
+func (muteAction) Execute(ctx context.Context, job db.Job) error {
+	accessToken, err := refreshAccessToken(job.Email)
+	if err != nil {
+		return err
+	}
+	return muteChannel(ctx, accessToken, job.ChannelID)
+}
+
+func (muteAction) Compensate(ctx context.Context, job db.Job) error {
+	return unmuteAction{}.Execute(ctx, job)
+}
+
+type unmuteAction struct{}
+
+func (unmuteAction) Execute(ctx context.Context, job db.Job) error {
+	accessToken, err := refreshAccessToken(job.Email)
+	if err != nil {
+		return err
+	}
+	return unmuteChannel(ctx, accessToken, job.ChannelID)
+}
+
+func (unmuteAction) Compensate(ctx context.Context, job db.Job) error {
+	return muteAction{}.Execute(ctx, job)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+func TestTimerRequestActions(t *testing.T) {
+	start, duration, timezone := "18:00", 60, "UTC"
+	channels := []string{"CT_1"}
+	request := func(actions []string, status *db.TimerStatus, channels []string) timerRequest {
+		return timerRequest{StartTime: &start, Duration: &duration, Timezone: &timezone, Channels: &channels, Status: status, Actions: &actions}
+	}
+	status := &db.TimerStatus{Message: "Focusing", Presence: "busy"}
+
+	tests := []struct {
+		name    string
+		req     timerRequest
+		partial bool
+		invalid []string
+	}{
+		{name: "default", req: timerRequest{StartTime: &start, Duration: &duration, Timezone: &timezone, Channels: &channels}},
+		{name: "mute only", req: request([]string{"MUTE", "UNMUTE"}, status, channels)},
+		{name: "status only without channels", req: request([]string{"SET_STATUS", "RESTORE_STATUS"}, status, []string{})},
+		{name: "empty runs everything", req: request([]string{}, nil, channels)},
+		{name: "unknown type", req: request([]string{"MUTE", "UNMUTE", "SEND_EMAIL"}, nil, channels), invalid: []string{"actions[2]"}},
+		{name: "lowercase type", req: request([]string{"mute", "UNMUTE"}, nil, channels), invalid: []string{"actions", "actions[0]"}},
+		{name: "not a window type", req: request([]string{"MUTE", "UNMUTE", "WEBHOOK"}, nil, channels), invalid: []string{"actions[2]"}},
+		{name: "duplicate", req: request([]string{"MUTE", "UNMUTE", "MUTE"}, nil, channels), invalid: []string{"actions[2]"}},
+		{name: "unpaired", req: request([]string{"MUTE"}, nil, channels), invalid: []string{"actions"}},
+		{name: "status without a status", req: request([]string{"SET_STATUS", "RESTORE_STATUS"}, nil, channels), invalid: []string{"actions[0]", "actions[1]"}},
+		{name: "status without a status on update", req: request([]string{"SET_STATUS", "RESTORE_STATUS"}, nil, channels), partial: true},
+		{name: "muting needs channels", req: request([]string{"MUTE", "UNMUTE"}, nil, []string{}), invalid: []string{"channels"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var invalid []string
+			for _, field := range tt.req.validate(tt.partial) {
+				invalid = append(invalid, field.Field)
+			}
+			if !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("invalid fields = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestTimerRuns(t *testing.T) {
+	timer := db.Timing{Status: &db.TimerStatus{Message: "Away"}}
+	if !timerRuns(timer, "MUTE") || !timerRuns(timer, "SET_STATUS") {
+		t.Error("timers without actions should run every job type")
+	}
+	timer.Actions = []string{"SET_STATUS", "RESTORE_STATUS"}
+	if timerRuns(timer, "MUTE") || !timerRuns(timer, "SET_STATUS") {
+		t.Error("timers with actions should only run those")
+	}
+}
+
+func TestActionTimeout(t *testing.T) {
+	if got := actionTimeout(jobActions["MUTE"]); got != jobTimeout {
+		t.Errorf("MUTE timeout = %s, want %s", got, jobTimeout)
+	}
+	// A digest reads up to maxDigestChannels channels and still has to send
+	if got := actionTimeout(jobActions["DIGEST"]); got != digestTimeout || got <= digestFetchTime {
+		t.Errorf("DIGEST timeout = %s, want %s", got, digestTimeout)
+	}
+}
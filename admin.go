@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// adminUserView is a user as shown to admins, without any secrets.
+type adminUserView struct {
+	Email           string          `json:"email"`
+	Role            string          `json:"role"`
+	Disabled        bool            `json:"disabled"`
+	DisabledAt      *time.Time      `json:"disabled_at,omitempty"`
+	Timers          int             `json:"timers"`
+	HasRefreshToken bool            `json:"has_refresh_token"`
+	TokenHealth     *db.TokenHealth `json:"token_health"`
+}
+
+func newAdminUserView(user db.User) adminUserView {
+	return adminUserView{
+		Email:           user.Email,
+		Role:            userRole(user),
+		Disabled:        user.Disabled,
+		DisabledAt:      user.DisabledAt,
+		Timers:          len(user.Timers),
+		HasRefreshToken: user.RefreshToken != "",
+		TokenHealth:     user.TokenHealth,
+	}
+}
+
+// disableUser disables an account and cancels its pending jobs, including
+// webhook deliveries. Windows that are running end right away.
+func disableUser(email string) error {
+	if err := db.SetUserDisabled(email, true); err != nil {
+		return err
+	}
+	pending, _, err := db.FindJobs(db.JobFilter{Email: email, Status: "PENDING"})
+	if err != nil {
+		return err
+	}
+	cancelled, running := splitFutureJobs(pending)
+	if err := db.RemoveUserJobs(email, cancelled); err != nil {
+		return err
+	}
+	for _, end := range running {
+		go executeJob(end)
+	}
+	log.Printf("Disabled user %s, cancelled %d pending jobs", email, len(cancelled))
+	return nil
+}
+
+// enableUser re-enables an account and regenerates its timer and holiday
+// jobs; feed jobs follow on the next feed sync.
+func enableUser(email string) error {
+	if err := db.SetUserDisabled(email, false); err != nil {
+		return err
+	}
+	if err := rescheduleUser(email); err != nil {
+		return err
+	}
+	log.Printf("Enabled user %s", email)
+	return nil
+}
+
+// listUsersHandler lists a page of all users.
+func listUsersHandler(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		return sendValidationError(c, []fieldError{{Field: "page", Message: "must be at least 1"}})
+	}
+	if limit < 1 || limit > 200 {
+		return sendValidationError(c, []fieldError{{Field: "limit", Message: "must be between 1 and 200"}})
+	}
+	audit(c, "users.list", "")
+
+	users, total, err := db.FindUsers(int64((page-1)*limit), int64(limit))
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list users")
+	}
+	views := make([]adminUserView, 0, len(users))
+	for _, user := range users {
+		views = append(views, newAdminUserView(user))
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"users": views,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// getAdminUserHandler returns a user with their token health.
+func getAdminUserHandler(c *fiber.Ctx) error {
+	email := c.Params("email")
+	audit(c, "user.get", email)
+	user, err := db.GetUser(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load user")
+	}
+	return c.Status(fiber.StatusOK).JSON(newAdminUserView(user))
+}
+
+// roleRequest is the JSON body of PUT /admin/users/:email/role:
+//
+//	{"role": "team-manager"}
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+func (r roleRequest) validate() []fieldError {
+	if _, ok := rolePermissions[r.Role]; !ok {
+		return []fieldError{{Field: "role", Message: "must be admin, team-manager or member"}}
+	}
+	return nil
+}
+
+// putRoleHandler changes the role of a user.
+func putRoleHandler(c *fiber.Ctx) error {
+	email := c.Params("email")
+	var req roleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	if err := db.SetUserRole(email, req.Role); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error setting role of user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to set role")
+	}
+	audit(c, "user.role."+req.Role, email)
+	return getAdminUserHandler(c)
+}
+
+// disableUserHandler disables an account; admins can't disable their own.
+func disableUserHandler(c *fiber.Ctx) error {
+	email := c.Params("email")
+	if actor, _ := c.Locals("actor").(string); actor == email {
+		return sendError(c, fiber.StatusConflict, "self_disable", "You can't disable your own account")
+	}
+	if err := disableUser(email); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error disabling user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to disable user")
+	}
+	audit(c, "user.disable", email)
+	return getAdminUserHandler(c)
+}
+
+// enableUserHandler re-enables a disabled account.
+func enableUserHandler(c *fiber.Ctx) error {
+	email := c.Params("email")
+	if err := enableUser(email); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error enabling user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to enable user")
+	}
+	audit(c, "user.enable", email)
+	return getAdminUserHandler(c)
+}
+
+// listAllJobsHandler lists a page of the jobs of all users, or of the user
+// given by the email query parameter.
+func listAllJobsHandler(c *fiber.Ctx) error {
+	audit(c, "jobs.list", c.Query("email"))
+	return listJobs(c, c.Query("email"))
+}
+
+// pendingJob loads the :id job of the route, answering the request itself
+// unless the job exists and is pending.
+func pendingJob(c *fiber.Ctx) (db.Job, bool, error) {
+	job, err := db.GetJob(c.Params("id"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return job, false, sendError(c, fiber.StatusNotFound, "not_found", "Job not found")
+		}
+		log.Printf("Error loading job %s: %v", c.Params("id"), err)
+		return job, false, sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load job")
+	}
+	if job.Status != "PENDING" {
+		return job, false, sendError(c, fiber.StatusConflict, "job_not_pending", "Job has already run")
+	}
+	return job, true, nil
+}
+
+// runJobHandler executes a pending job now instead of at its time.
+func runJobHandler(c *fiber.Ctx) error {
+	job, ok, err := pendingJob(c)
+	if !ok {
+		return err
+	}
+	audit(c, "job.run", job.ID)
+	executeJob(job)
+
+	job, err = db.GetJob(job.ID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Job was cancelled while running")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load job")
+	}
+	return c.Status(fiber.StatusOK).JSON(job)
+}
+
+// cancelJobHandler deletes a pending job. Cancelling the UNMUTE of a running
+// window leaves its channel muted.
+func cancelJobHandler(c *fiber.Ctx) error {
+	job, ok, err := pendingJob(c)
+	if !ok {
+		return err
+	}
+	if err := db.RemoveJobs([]string{job.ID}); err != nil {
+		log.Printf("Error cancelling job %s: %v", job.ID, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to cancel job")
+	}
+	audit(c, "job.cancel", job.ID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPISpec documents the /api/v1 routes; keep it in sync with registerAPIv1.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// registerAPIv1 mounts the versioned, resource-oriented API.
+func registerAPIv1(app *fiber.App) {
+	v1 := app.Group("/api/v1")
+	v1.Get("/openapi.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(openAPISpec)
+	})
+	v1.Get("/calendar.ics", calendarFeedHandler)
+	v1.Get("/holidays/countries", listCountriesHandler)
+	v1.Post("/holidays/calendars", requireAdmin, createHolidayCalendarHandler)
+
+	users := v1.Group("/users/:email", requireAuth, pathUser)
+	users.Get("", getUserHandler)
+
+	users.Get("/timers", listTimersHandler)
+	users.Post("/timers", requireJSON, createTimerHandler)
+	users.Get("/timers/:id", getTimerHandler)
+	users.Patch("/timers/:id", requireJSON, updateTimerHandler)
+	users.Delete("/timers/:id", deleteTimerHandler)
+	users.Post("/timers/:id/pause", pauseTimerHandler)
+	users.Post("/timers/:id/resume", resumeTimerHandler)
+	users.Post("/timers/:id/exceptions", requireJSON, addExceptionHandler)
+	users.Delete("/timers/:id/exceptions/:date", removeExceptionHandler)
+
+	users.Get("/jobs", listJobsHandler)
+	users.Get("/jobs/:id", getJobHandler)
+
+	users.Get("/channels", listChannelsHandler)
+
+	users.Get("/holidays", getHolidaysHandler)
+	users.Put("/holidays", requireJSON, putHolidaysHandler)
+	users.Delete("/holidays", deleteHolidaysHandler)
+
+	users.Get("/feeds", listFeedsHandler)
+	users.Post("/feeds", createFeedHandler)
+	users.Put("/feeds/:id/content", putFeedContentHandler)
+	users.Post("/feeds/:id/sync", syncFeedHandler)
+	users.Delete("/feeds/:id", deleteFeedHandler)
+
+	users.Post("/calendar/token", calendarTokenHandler)
+
+	users.Get("/groups", listGroupsHandler)
+	users.Get("/groups/:name", getGroupHandler)
+	users.Put("/groups/:name", requireJSON, putGroupHandler)
+	users.Delete("/groups/:name", deleteGroupHandler)
+
+	users.Get("/auto-reply", getAutoReplyHandler)
+	users.Put("/auto-reply", requireJSON, putAutoReplyHandler)
+	users.Delete("/auto-reply", deleteAutoReplyHandler)
+
+	users.Get("/urgent-alerts", listUrgentAlertsHandler)
+
+	users.Get("/webhooks", listWebhooksHandler)
+	users.Post("/webhooks", requireJSON, createWebhookHandler)
+	users.Delete("/webhooks/:id", deleteWebhookHandler)
+	users.Get("/webhooks/:id/deliveries", listDeliveriesHandler)
+
+	teams := v1.Group("/teams", requireAuth)
+	teams.Get("", listTeamsHandler)
+	teams.Post("", requirePermission(permCreateTeams), requireJSON, createTeamHandler)
+	team := teams.Group("/:team", loadTeam)
+	team.Get("", getTeamHandler)
+	team.Post("/accept", acceptInviteHandler)
+	team.Delete("", requireTeamManager, deleteTeamHandler)
+	team.Put("/members/:member", requireTeamManager, requireJSON, putMemberHandler)
+	team.Delete("/members/:member", deleteMemberHandler)
+	team.Post("/policies", requireTeamManager, requireJSON, createPolicyHandler)
+	team.Put("/policies/:policy", requireTeamManager, requireJSON, putPolicyHandler)
+	team.Delete("/policies/:policy", requireTeamManager, deletePolicyHandler)
+	team.Post("/policies/:policy/opt-out", optOutHandler)
+	team.Delete("/policies/:policy/opt-out", optInHandler)
+
+	admin := v1.Group("/admin", requireAdmin)
+	admin.Get("/users", listUsersHandler)
+	admin.Get("/users/:email", getAdminUserHandler)
+	admin.Put("/users/:email/role", requireJSON, putRoleHandler)
+	admin.Post("/users/:email/disable", disableUserHandler)
+	admin.Post("/users/:email/enable", enableUserHandler)
+	admin.Get("/users/:email/token", tokenDiagnosticsHandler)
+	admin.Get("/jobs", listAllJobsHandler)
+	admin.Post("/jobs/:id/run", runJobHandler)
+	admin.Post("/jobs/:id/cancel", cancelJobHandler)
+}
+
+// pathUser only lets users access their own /api/v1/users/:email routes;
+// "me" stands for the authenticated user.
+func pathUser(c *fiber.Ctx) error {
+	if email := c.Params("email"); email != "me" && !strings.EqualFold(email, userEmail(c)) {
+		return sendError(c, fiber.StatusForbidden, "forbidden", "Not allowed to access another user")
+	}
+	return c.Next()
+}
+
+// requireJSON rejects request bodies that aren't JSON; the deprecated
+// query-string form is only accepted on the legacy routes.
+func requireJSON(c *fiber.Ctx) error {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		return sendError(c, fiber.StatusUnsupportedMediaType, "unsupported_media_type", "Request body must be application/json")
+	}
+	return c.Next()
+}
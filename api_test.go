@@ -0,0 +1,403 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The contract tests check registerAPIv1 against openapi.json: every route is
+// documented and every documented operation exists, and the answers of each
+// route have a documented status and match its schema. No database is
+// connected, so most authenticated requests end in the error envelope.
+
+type specOperation struct {
+	Security  []map[string][]string `json:"security"`
+	Responses map[string]struct {
+		Ref     string `json:"$ref"`
+		Content map[string]struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type apiSpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]json.RawMessage `json:"schemas"`
+		Responses map[string]struct {
+			Content map[string]struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"content"`
+		} `json:"responses"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) apiSpec {
+	t.Helper()
+	var spec apiSpec
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return spec
+}
+
+// operations returns the documented operations as "METHOD /path".
+func (s apiSpec) operations(t *testing.T) map[string]specOperation {
+	t.Helper()
+	ops := map[string]specOperation{}
+	for path, item := range s.Paths {
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op specOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+			ops[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return ops
+}
+
+// responseSchema returns the JSON schema of a documented response, if any.
+func (s apiSpec) responseSchema(op specOperation, status string) (json.RawMessage, bool) {
+	response := op.Responses[status]
+	content := response.Content
+	if name, ok := strings.CutPrefix(response.Ref, "#/components/responses/"); ok {
+		content = s.Components.Responses[name].Content
+	}
+	media, ok := content[fiber.MIMEApplicationJSON]
+	return media.Schema, ok
+}
+
+// validate checks a decoded JSON value against a schema. It supports the
+// subset of JSON Schema openapi.json uses and, unlike JSON Schema, rejects
+// properties a schema doesn't declare so that the document can't drift.
+func (s apiSpec) validate(schema json.RawMessage, value any, path string) []string {
+	var sch struct {
+		Ref                  string                     `json:"$ref"`
+		AllOf                []json.RawMessage          `json:"allOf"`
+		Type                 string                     `json:"type"`
+		Nullable             bool                       `json:"nullable"`
+		Required             []string                   `json:"required"`
+		Properties           map[string]json.RawMessage `json:"properties"`
+		AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+		Items                json.RawMessage            `json:"items"`
+		Enum                 []any                      `json:"enum"`
+	}
+	if err := json.Unmarshal(schema, &sch); err != nil {
+		return []string{fmt.Sprintf("%s: bad schema: %v", path, err)}
+	}
+	if name, ok := strings.CutPrefix(sch.Ref, "#/components/schemas/"); ok {
+		ref, found := s.Components.Schemas[name]
+		if !found {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, name)}
+		}
+		return s.validate(ref, value, path)
+	}
+	if len(sch.AllOf) > 0 {
+		return s.validateAllOf(sch.AllOf, value, path)
+	}
+	if value == nil {
+		if sch.Nullable || sch.Type == "" {
+			return nil
+		}
+		return []string{path + ": is null"}
+	}
+	if len(sch.Enum) > 0 && !slices.Contains(sch.Enum, value) {
+		return []string{fmt.Sprintf("%s: %v is not one of %v", path, value, sch.Enum)}
+	}
+
+	var errs []string
+	switch sch.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{path + ": is not an object"}
+		}
+		for _, name := range sch.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing %s", path, name))
+			}
+		}
+		for name, v := range obj {
+			if prop, ok := sch.Properties[name]; ok {
+				errs = append(errs, s.validate(prop, v, path+"."+name)...)
+			} else if len(sch.AdditionalProperties) > 0 && string(sch.AdditionalProperties) != "false" {
+				errs = append(errs, s.validate(sch.AdditionalProperties, v, path+"."+name)...)
+			} else if sch.Properties != nil {
+				errs = append(errs, fmt.Sprintf("%s: undocumented property %s", path, name))
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return []string{path + ": is not an array"}
+		}
+		for i, v := range arr {
+			errs = append(errs, s.validate(sch.Items, v, path+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, path+": is not a string")
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (sch.Type == "integer" && n != float64(int64(n))) {
+			errs = append(errs, fmt.Sprintf("%s: is not an %s", path, sch.Type))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, path+": is not a boolean")
+		}
+	}
+	return errs
+}
+
+// validateAllOf validates an object against the union of the properties of
+// the allOf schemas, so that each part doesn't reject the others' properties.
+func (s apiSpec) validateAllOf(parts []json.RawMessage, value any, path string) []string {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return []string{path + ": is not an object"}
+	}
+	var errs []string
+	declared := map[string]bool{}
+	for _, part := range parts {
+		var sch struct {
+			Ref        string                     `json:"$ref"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		json.Unmarshal(part, &sch)
+		if name, ok := strings.CutPrefix(sch.Ref, "#/components/schemas/"); ok {
+			part = s.Components.Schemas[name]
+			json.Unmarshal(part, &sch)
+		}
+		own := map[string]any{}
+		for name := range sch.Properties {
+			declared[name] = true
+			if v, ok := obj[name]; ok {
+				own[name] = v
+			}
+		}
+		errs = append(errs, s.validate(part, own, path)...)
+	}
+	for name := range obj {
+		if !declared[name] {
+			errs = append(errs, fmt.Sprintf("%s: undocumented property %s", path, name))
+		}
+	}
+	return errs
+}
+
+var routeParam = regexp.MustCompile(`:(\w+)`)
+
+// newTestApp returns the v1 API, authenticating "Bearer member" and
+// "Bearer admin" as users with those roles and "Bearer root" as the
+// ADMIN_API_KEY.
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("ADMIN_API_KEY", "root")
+	previous := lookupAPIKey
+	lookupAPIKey = func(hash string) (db.User, error) {
+		switch hash {
+		case hashToken("member"):
+			return db.User{Email: "member@example.com"}, nil
+		case hashToken("admin"):
+			return db.User{Email: "admin@example.com", Role: roleAdmin}, nil
+		}
+		return previous(hash)
+	}
+	t.Cleanup(func() { lookupAPIKey = previous })
+
+	app := fiber.New()
+	registerAPIv1(app)
+	return app
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	spec := loadSpec(t)
+	ops := spec.operations(t)
+	app := newTestApp(t)
+
+	routes := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		path, ok := strings.CutPrefix(route.Path, "/api/v1")
+		if !ok {
+			continue
+		}
+		path = routeParam.ReplaceAllString(strings.TrimSuffix(path, "/"), "{$1}")
+		routes[route.Method+" "+path] = true
+	}
+
+	for route := range routes {
+		if _, ok := ops[route]; !ok {
+			t.Errorf("%s is not documented in openapi.json", route)
+		}
+	}
+	for op := range ops {
+		if !routes[op] {
+			t.Errorf("openapi.json documents %s, which isn't registered", op)
+		}
+	}
+}
+
+// testPathParams are the values substituted for path parameters.
+var testPathParams = map[string]string{
+	"email":  "me",
+	"date":   "2026-01-05",
+	"id":     "x",
+	"name":   "focus",
+	"team":   "x",
+	"member": "member@example.com",
+	"policy": "x",
+}
+
+func TestRoutesAnswerAsDocumented(t *testing.T) {
+	spec := loadSpec(t)
+	app := newTestApp(t)
+
+	ops := spec.operations(t)
+	keys := make([]string, 0, len(ops))
+	for key := range ops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		op := ops[key]
+		method, path, _ := strings.Cut(key, " ")
+		target := "/api/v1" + regexp.MustCompile(`\{(\w+)\}`).ReplaceAllStringFunc(path, func(p string) string {
+			return testPathParams[strings.Trim(p, "{}")]
+		})
+		if path == "/calendar.ics" {
+			target += "?token=x"
+		}
+
+		public := op.Security != nil && len(op.Security) == 0
+		admin := op.Security != nil && len(op.Security) > 0 && op.Security[0]["adminKey"] != nil
+		keys := []string{"", "member", "admin", "root"}
+		if public {
+			keys = []string{""}
+		}
+
+		for _, apiKey := range keys {
+			t.Run(key+" as "+cmp.Or(apiKey, "anonymous"), func(t *testing.T) {
+				var body io.Reader
+				req := httptest.NewRequest(method, target, nil)
+				if method == fiber.MethodPost || method == fiber.MethodPut || method == fiber.MethodPatch {
+					body = strings.NewReader(`{}`)
+					req = httptest.NewRequest(method, target, body)
+					req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				}
+				if apiKey != "" {
+					req.Header.Set(fiber.HeaderAuthorization, "Bearer "+apiKey)
+				}
+				resp, err := app.Test(req, int((10 * time.Second).Milliseconds()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+
+				status := strconv.Itoa(resp.StatusCode)
+				if _, ok := op.Responses[status]; !ok {
+					t.Fatalf("answered %s, which isn't documented", status)
+				}
+				if !public && apiKey == "" {
+					want := http.StatusUnauthorized
+					if admin {
+						want = http.StatusForbidden
+					}
+					if resp.StatusCode != want {
+						t.Errorf("answered %d without an API key, want %d", resp.StatusCode, want)
+					}
+				}
+				if admin && apiKey == "member" && resp.StatusCode != http.StatusForbidden {
+					t.Errorf("answered %d to a member, want 403", resp.StatusCode)
+				}
+
+				schema, ok := spec.responseSchema(op, status)
+				if !ok {
+					return
+				}
+				var decoded any
+				if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+					t.Fatalf("answered %s with invalid JSON: %v", status, err)
+				}
+				for _, e := range spec.validate(schema, decoded, "body") {
+					t.Errorf("answered %s: %s", status, e)
+				}
+			})
+		}
+	}
+}
+
+// TestSchemasMatchTypes checks that the JSON encodings of the stored types
+// returned by the API match their schemas.
+func TestSchemasMatchTypes(t *testing.T) {
+	spec := loadSpec(t)
+	now := time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)
+
+	values := map[string]any{
+		"Timing": db.Timing{
+			ID: "t1", StartTime: "18:00", Duration: 60, IsDaily: true, Timezone: "UTC", Channels: []string{"CT_1"},
+			Paused: true, PausedAt: &now, ResumeAt: &now,
+			Exceptions: []db.TimerException{{Date: "2026-01-06", StartTime: "19:00", Duration: 30}},
+			Status:     &db.TimerStatus{Message: "Focusing"},
+		},
+		"Job": db.Job{
+			ID: "j1", Email: "a@example.com", TaskType: "MUTE", ChannelID: "CT_1", ExecuteAt: now,
+			Status: "PENDING", TimerID: "t1", Payload: map[string]string{"message": "Focusing"},
+		},
+		"HolidaySettings": db.HolidaySettings{CalendarID: "builtin:IN", Channels: []string{"CT_1"}, Timezone: "Asia/Kolkata"},
+		"HolidayCalendar": db.HolidayCalendar{ID: "c1", Name: "Office", Holidays: []db.Holiday{{Date: "2026-01-26", Name: "Republic Day"}}},
+		"CalendarFeed": db.CalendarFeed{
+			ID: "f1", Email: "a@example.com", URL: "https://example.com/me.ics", Categories: []string{"Focus"},
+			Channels: []string{"CT_1"}, Timezone: "UTC", ContentHash: "abc", LastFetchedAt: &now, LastError: feedFetchError,
+			HorizonAt: &now,
+		},
+		"ChannelGroup": db.ChannelGroup{Name: "focus", Channels: []string{"CT_1"}},
+		"Team": db.Team{
+			ID: "team1", Name: "Platform", CreatedAt: now,
+			Members: []db.TeamMember{
+				{Email: "a@example.com", Role: "manager", OptedOut: []string{"p1"}},
+				{Email: "b@example.com", Role: "member", Pending: true},
+			},
+			Policies: []db.TeamPolicy{{ID: "p1", Name: "Evenings", AllowOptOut: true, Timer: db.Timing{StartTime: "19:00", Duration: 720}, UpdatedAt: now}},
+		},
+	}
+	for name, value := range values {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("openapi.json has no %s schema", name)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded any
+		json.Unmarshal(encoded, &decoded)
+		for _, e := range spec.validate(schema, decoded, name) {
+			t.Error(e)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// newToken returns a random secret token and the hash to store for it.
+// Only hashes of API keys and feed tokens are kept in the database.
+func newToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Roles of users. Users without a stored role are members.
+const (
+	roleAdmin       = "admin"
+	roleTeamManager = "team-manager"
+	roleMember      = "member"
+)
+
+// Permissions granted by roles beyond a member's access to their own data.
+const (
+	permAdmin          = "admin"            // the /api/v1/admin routes
+	permCreateTeams    = "teams.create"     // creating teams
+	permManageAllTeams = "teams.manage_all" // managing teams without being their manager
+)
+
+var rolePermissions = map[string][]string{
+	roleAdmin:       {permAdmin, permCreateTeams, permManageAllTeams},
+	roleTeamManager: {permCreateTeams},
+	roleMember:      {},
+}
+
+var (
+	errMissingAPIKey   = errors.New("missing API key")
+	errInvalidAPIKey   = errors.New("invalid API key")
+	errAccountDisabled = errors.New("account disabled")
+)
+
+// lookupAPIKey finds the user owning an API key hash.
+var lookupAPIKey = db.GetUserByAPIKeyHash
+
+// userRole returns the role of a user, defaulting to member.
+func userRole(user db.User) string {
+	if user.Role == "" {
+		return roleMember
+	}
+	return user.Role
+}
+
+// can reports whether the authenticated user's role grants a permission.
+func can(c *fiber.Ctx, permission string) bool {
+	role, _ := c.Locals("role").(string)
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// requirePermission only lets users whose role grants the permission
+// through; it runs after requireAuth.
+func requirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !can(c, permission) {
+			return sendError(c, fiber.StatusForbidden, "forbidden", "Your role doesn't allow this")
+		}
+		return c.Next()
+	}
+}
+
+// authenticate returns the user owning the API key of the request, sent as
+// "Authorization: Bearer <key>". Disabled users are rejected.
+func authenticate(c *fiber.Ctx) (db.User, error) {
+	key, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || key == "" {
+		return db.User{}, errMissingAPIKey
+	}
+	user, err := lookupAPIKey(hashToken(key))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, errInvalidAPIKey
+	}
+	if err == nil && user.Disabled {
+		return user, errAccountDisabled
+	}
+	return user, err
+}
+
+// sendAuthError answers a request that failed authenticate.
+func sendAuthError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errMissingAPIKey):
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Missing API key")
+	case errors.Is(err, errInvalidAPIKey):
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Invalid API key")
+	case errors.Is(err, errAccountDisabled):
+		return sendError(c, fiber.StatusForbidden, "account_disabled", "Your account is disabled")
+	}
+	log.Printf("Error authenticating request: %v", err)
+	return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to authenticate")
+}
+
+// requireAuth authenticates the request by its API key and binds it to the
+// key's user and their role.
+func requireAuth(c *fiber.Ctx) error {
+	user, err := authenticate(c)
+	if err != nil {
+		return sendAuthError(c, err)
+	}
+	c.Locals("email", user.Email)
+	c.Locals("role", userRole(user))
+	return c.Next()
+}
+
+// requireAdmin lets admins through, authenticated either by their API key or
+// by the ADMIN_API_KEY environment variable, which operators use to appoint
+// the first admins.
+func requireAdmin(c *fiber.Ctx) error {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	key, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1 {
+		c.Locals("actor", "admin")
+		c.Locals("role", roleAdmin)
+		return c.Next()
+	}
+
+	user, err := authenticate(c)
+	if err != nil {
+		if errors.Is(err, errMissingAPIKey) || errors.Is(err, errInvalidAPIKey) {
+			return sendError(c, fiber.StatusForbidden, "forbidden", "Admin access required")
+		}
+		return sendAuthError(c, err)
+	}
+	c.Locals("email", user.Email)
+	c.Locals("role", userRole(user))
+	if !can(c, permAdmin) {
+		return sendError(c, fiber.StatusForbidden, "forbidden", "Admin access required")
+	}
+	c.Locals("actor", user.Email)
+	return c.Next()
+}
+
+// audit records a privileged operation in the audit log.
+func audit(c *fiber.Ctx, action string, target string) {
+	actor, _ := c.Locals("actor").(string)
+	log.Printf("AUDIT: %s %s %s from %s", actor, action, target, c.IP())
+	entry := db.AuditEntry{Actor: actor, Action: action, Target: target, At: time.Now()}
+	if err := db.AddAuditEntry(entry); err != nil {
+		log.Printf("Error writing audit entry for %s %s: %v", action, target, err)
+	}
+}
+
+// zohoUserEmail asks Zoho Accounts which user an access token belongs to, so
+// the identity of a new user never comes from request parameters.
+func zohoUserEmail(accessToken string) (string, error) {
+	req, err := http.NewRequest("GET", "https://accounts.zoho.com/oauth/user/info", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", "Zoho-oauthtoken "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting user info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get user info: status %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var info struct {
+		Email string `json:"Email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("error decoding user info: %w", err)
+	}
+	if info.Email == "" {
+		return "", fmt.Errorf("user info has no email")
+	}
+	return info.Email, nil
+}
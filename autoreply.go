@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// defaultAutoReply is sent when the user turned the auto-reply on without a
+// message of their own.
+const defaultAutoReply = "I'm in quiet hours until {end} and will get back to you then."
+
+const maxAutoReplyLength = 1000
+
+// recordAutoReply notes the auto-reply to a sender in a window, reporting
+// false if they already got it.
+var recordAutoReply = db.RecordAutoReply
+
+// cliqIncomingMessage is the payload the extension's message handler posts
+// for each message a connected user receives. User is the recipient.
+type cliqIncomingMessage struct {
+	User   cliqUser `json:"user"`
+	Sender cliqUser `json:"sender"`
+	Chat   struct {
+		ID    string `json:"id"`
+		Type  string `json:"type"` // "dm", "chat", "channel" or "bot"
+		Title string `json:"title"`
+	} `json:"chat"`
+	Message struct {
+		ID   string `json:"id"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// incomingMessageHandler receives the messages of connected users. During
+// a quiet window it sends the auto-reply to DMs and forwards messages of
+// muted channels that match urgent rules. Cliq gets no reply content;
+// failures are only logged. The recipient is taken from the payload, so the
+// route must only be reachable through verifyCliqSignature.
+func incomingMessageHandler(c *fiber.Ctx) error {
+	var req cliqIncomingMessage
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if req.User.Email == "" || req.Sender.ID == "" || req.Sender.ID == req.User.ID || req.Chat.ID == "" {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	user, err := db.GetUser(req.User.Email)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error loading Cliq user %s: %v", req.User.Email, err)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	if user.Disabled {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	windows, err := activeWindows(user.Email, time.Now())
+	if err != nil {
+		log.Printf("Error finding active windows of user %s: %v", user.Email, err)
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	if len(windows) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	if req.Chat.Type == "dm" && user.AutoReply != nil {
+		if err := autoReply(user, req, windows); err != nil {
+			log.Printf("Error auto-replying to %s for user %s: %v", req.Sender.ID, user.Email, err)
+		}
+	}
+	if err := checkUrgent(user.Email, req, windows); err != nil {
+		log.Printf("Error checking urgent rules for user %s: %v", user.Email, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// autoReply answers a DM during the user's active windows, once per sender
+// and window.
+func autoReply(user db.User, req cliqIncomingMessage, windows []window) error {
+	// Overlapping windows: the user is quiet until the last one ends
+	latest := windows[0]
+	for _, w := range windows[1:] {
+		if w.UnmuteAt.After(latest.UnmuteAt) {
+			latest = w
+		}
+	}
+
+	first, err := recordAutoReply(user.Email, latest.id(), req.Sender.ID)
+	if err != nil || !first {
+		return err
+	}
+	text := strings.ReplaceAll(user.AutoReply.Message, "{end}", formatWindowEnd(latest, req.Sender.Timezone, user.Email))
+
+	accessToken, err := refreshAccessToken(user.Email)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := cliqPost(ctx, accessToken, "/chats/"+req.Chat.ID+"/message", map[string]string{"text": text}); err != nil {
+		return err
+	}
+	log.Printf("Sent auto-reply to %s for user %s (window %s)", req.Sender.ID, user.Email, latest.id())
+	return nil
+}
+
+// formatWindowEnd renders the end of a window in the sender's timezone,
+// falling back to the timer's, with the weekday if it isn't today there.
+func formatWindowEnd(w window, timezone string, email string) string {
+	loc, err := time.LoadLocation(timezone)
+	if timezone == "" || err != nil {
+		loc = time.UTC
+		if timer, err := db.GetTimer(email, w.TimerID); err == nil {
+			if timerLoc, err := timerLocation(timer); err == nil {
+				loc = timerLoc
+			}
+		}
+	}
+	end := w.UnmuteAt.In(loc)
+	if end.Format("2006-01-02") != time.Now().In(loc).Format("2006-01-02") {
+		return end.Format("Mon 15:04 MST")
+	}
+	return end.Format("15:04 MST")
+}
+
+// autoReplyRequest is the JSON body of PUT /auto-reply:
+//
+//	{"message": "Off for the evening, back at {end}."}
+type autoReplyRequest struct {
+	Message string `json:"message"`
+}
+
+func (r autoReplyRequest) validate() []fieldError {
+	if len(r.Message) > maxAutoReplyLength {
+		return []fieldError{{Field: "message", Message: "must be at most 1000 characters"}}
+	}
+	return nil
+}
+
+// getAutoReplyHandler returns the user's auto-reply, or 404 if it is off.
+func getAutoReplyHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	user, err := db.GetUser(email)
+	if err != nil {
+		log.Printf("Error loading user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load auto-reply")
+	}
+	if user.AutoReply == nil {
+		return sendError(c, fiber.StatusNotFound, "not_found", "Auto-reply is off")
+	}
+	return c.Status(fiber.StatusOK).JSON(user.AutoReply)
+}
+
+// putAutoReplyHandler turns the auto-reply on or changes its message.
+func putAutoReplyHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	var req autoReplyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	settings := &db.AutoReply{Message: strings.TrimSpace(req.Message)}
+	if settings.Message == "" {
+		settings.Message = defaultAutoReply
+	}
+	if err := db.SetAutoReply(email, settings); err != nil {
+		log.Printf("Error saving auto-reply for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save auto-reply")
+	}
+	log.Printf("Turned on auto-reply for user %s", email)
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
+
+// deleteAutoReplyHandler turns the auto-reply off.
+func deleteAutoReplyHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	if err := db.SetAutoReply(email, nil); err != nil {
+		log.Printf("Error removing auto-reply for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to turn off auto-reply")
+	}
+	log.Printf("Turned off auto-reply for user %s", email)
+	return c.SendStatus(fiber.StatusNoContent)
+}
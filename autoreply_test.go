@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCliqRoutesRequireSignature(t *testing.T) {
+	signingKey(t)
+	app := fiber.New()
+	registerCliqRoutes(app)
+
+	routes := 0
+	for _, route := range app.GetRoutes(true) {
+		if route.Method != fiber.MethodPost {
+			continue
+		}
+		routes++
+		body := `{"user":{"email":"victim@example.com"},"sender":{"id":"1"},"chat":{"id":"CT_1","type":"dm"}}`
+		req := httptest.NewRequest(fiber.MethodPost, route.Path, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("unsigned POST %s = %d, want 401", route.Path, resp.StatusCode)
+		}
+	}
+	if routes != 5 {
+		t.Errorf("checked %d routes, want the 5 Cliq endpoints", routes)
+	}
+}
+
+func TestAutoReplyOncePerSenderAndWindow(t *testing.T) {
+	// An in-memory RecordAutoReply; the real one relies on the unique _id
+	recorded := map[string]bool{}
+	previous := recordAutoReply
+	recordAutoReply = func(email string, windowID string, senderID string) (bool, error) {
+		key := email + "/" + windowID + "/" + senderID
+		first := !recorded[key]
+		recorded[key] = true
+		return first, nil
+	}
+	t.Cleanup(func() { recordAutoReply = previous })
+
+	at := time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)
+	evening := window{TimerID: "t1", MuteAt: at, UnmuteAt: at.Add(2 * time.Hour)}
+	overlapping := window{TimerID: "t2", MuteAt: at.Add(time.Hour), UnmuteAt: at.Add(3 * time.Hour)}
+	nextDay := window{TimerID: "t1", MuteAt: at.AddDate(0, 0, 1), UnmuteAt: at.AddDate(0, 0, 1).Add(2 * time.Hour)}
+	user := db.User{Email: "ana@example.com", AutoReply: &db.AutoReply{Message: "Back at {end}"}}
+	dm := func(sender string) cliqIncomingMessage {
+		var req cliqIncomingMessage
+		req.Sender.ID = sender
+		req.Sender.Timezone = "UTC"
+		req.Chat.ID = "DM_" + sender
+		return req
+	}
+
+	// Without a database, sending the reply fails while getting an access
+	// token, so an error means a reply was attempted
+	tests := []struct {
+		sender  string
+		windows []window
+		replies bool
+	}{
+		{"bob", []window{evening, overlapping}, true},
+		{"bob", []window{evening, overlapping}, false},
+		{"bob", []window{overlapping}, false}, // the same latest window
+		{"carol", []window{evening, overlapping}, true},
+		{"bob", []window{nextDay}, true},
+		{"bob", []window{nextDay}, false},
+	}
+	for i, tt := range tests {
+		err := autoReply(user, dm(tt.sender), tt.windows)
+		if replies := err != nil; replies != tt.replies {
+			t.Errorf("message %d from %s: replied = %t (%v), want %t", i, tt.sender, replies, err, tt.replies)
+		}
+	}
+	if len(recorded) != 3 {
+		t.Errorf("recorded %d auto-replies, want 3: %v", len(recorded), recorded)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/EthicalGopher/AfterWork_Buddy/ical"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// timerEvents renders a timer as VEVENTs: a daily recurring event with
+// EXDATEs for skipped dates and RECURRENCE-ID overrides for shifted ones.
+// Paused timers start at their resume date, or are left out entirely.
+func timerEvents(timer db.Timing, now time.Time) ([]ical.Event, error) {
+	from := now
+	if timer.Paused {
+		if timer.ResumeAt == nil {
+			return nil, nil
+		}
+		if timer.ResumeAt.After(now) {
+			from = *timer.ResumeAt
+		}
+	}
+	unpaused := timer
+	unpaused.Paused = false
+
+	event := ical.Event{
+		UID:         timer.ID + "@afterwork-buddy",
+		Summary:     "Quiet hours",
+		Description: "Muted channels: " + channelSummary(timer),
+		Categories:  []string{"AfterWork Buddy"},
+	}
+
+	if !timer.IsDaily {
+		muteAt, unmuteAt, ok, err := nextWindow(unpaused, from)
+		if err != nil || !ok {
+			return nil, err
+		}
+		event.Start, event.End = muteAt, unmuteAt
+		return []ical.Event{event}, nil
+	}
+
+	// The series starts at the next regular occurrence, ignoring exceptions
+	regular := unpaused
+	regular.Exceptions = nil
+	muteAt, unmuteAt, ok, err := nextWindow(regular, from)
+	if err != nil || !ok {
+		return nil, err
+	}
+	event.Start, event.End = muteAt, unmuteAt
+	event.RRule = "FREQ=DAILY"
+
+	loc := muteAt.Location()
+	var overrides []ical.Event
+	seen := make(map[string]bool)
+	for _, ex := range timer.Exceptions {
+		// The first exception of a date wins, as in nextWindow, so a holiday
+		// skip doesn't also exclude a date the timer shifts
+		if seen[ex.Date] {
+			continue
+		}
+		seen[ex.Date] = true
+		date, err := time.ParseInLocation("2006-01-02", ex.Date, loc)
+		if err != nil {
+			continue
+		}
+		original := time.Date(date.Year(), date.Month(), date.Day(), muteAt.Hour(), muteAt.Minute(), 0, 0, loc)
+		if original.Before(muteAt) {
+			continue
+		}
+		if ex.Skip {
+			event.ExDates = append(event.ExDates, original)
+			continue
+		}
+
+		shifted := event
+		shifted.RRule = ""
+		shifted.ExDates = nil
+		shifted.RecurrenceID = original
+		shifted.Start = original
+		if ex.StartTime != "" {
+			if parsed, err := time.Parse("15:04", ex.StartTime); err == nil {
+				shifted.Start = time.Date(date.Year(), date.Month(), date.Day(), parsed.Hour(), parsed.Minute(), 0, 0, loc)
+			}
+		}
+		duration := time.Duration(timer.Duration) * time.Minute
+		if ex.Duration > 0 {
+			duration = time.Duration(ex.Duration) * time.Minute
+		}
+		shifted.End = shifted.Start.Add(duration)
+		overrides = append(overrides, shifted)
+	}
+	return append([]ical.Event{event}, overrides...), nil
+}
+
+// writeUserCalendar renders the timers of a user as an iCalendar feed.
+func writeUserCalendar(w io.Writer, user db.User) error {
+	cal := ical.Calendar{
+		ProdID: "-//AfterWork Buddy//Quiet Hours//EN",
+		Name:   "Quiet hours",
+	}
+	now := time.Now()
+	for _, timer := range user.Timers {
+		events, err := timerEvents(withHolidaySkips(user.Email, timer), now)
+		if err != nil {
+			return err
+		}
+		cal.Events = append(cal.Events, events...)
+	}
+	return ical.Write(w, cal)
+}
+
+// calendarTokenHandler issues a new secret token for the user's calendar
+// feed. The token is only shown once; issuing a new one revokes the old feed
+// URL.
+func calendarTokenHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	token, hash, err := newToken()
+	if err != nil {
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to create token")
+	}
+	if err := db.SetFeedTokenHash(email, hash); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error saving calendar feed token for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save token")
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token": token,
+		"url":   hostUrl + "/api/v1/calendar.ics?token=" + token,
+	})
+}
+
+// calendarFeedHandler renders the calendar of the user owning the token
+// query parameter; calendar apps can't send an API key.
+func calendarFeedHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Missing calendar token")
+	}
+	user, err := db.GetUserByFeedTokenHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Unknown calendar feed")
+		}
+		log.Printf("Error loading calendar feed: %v", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load calendar")
+	}
+	if user.Disabled {
+		return sendError(c, fiber.StatusForbidden, "account_disabled", "Account disabled")
+	}
+
+	var buf bytes.Buffer
+	if err := writeUserCalendar(&buf, user); err != nil {
+		log.Printf("Error rendering calendar of user %s: %v", user.Email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to render calendar")
+	}
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/EthicalGopher/AfterWork_Buddy/ical"
+)
+
+func TestTimerEventsExceptions(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	timer := db.Timing{
+		ID:        "t1",
+		StartTime: "18:00",
+		Duration:  90,
+		IsDaily:   true,
+		Timezone:  "Europe/Berlin",
+		Channels:  []string{"CT_1"},
+		Exceptions: []db.TimerException{
+			{Date: "2026-03-05", StartTime: "20:00"},
+			{Date: "2026-03-06", Skip: true},
+			// Holiday skips are appended after the timer's own exceptions
+			{Date: "2026-03-05", Skip: true},
+			{Date: "2026-03-06", Skip: true},
+		},
+	}
+
+	events, err := timerEvents(timer, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want the series and one override", len(events))
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	series, override := events[0], events[1]
+	if series.RRule != "FREQ=DAILY" || !series.Start.Equal(time.Date(2026, time.March, 1, 18, 0, 0, 0, berlin)) {
+		t.Errorf("series = %+v", series)
+	}
+	if len(series.ExDates) != 1 || !series.ExDates[0].Equal(time.Date(2026, time.March, 6, 18, 0, 0, 0, berlin)) {
+		t.Errorf("exdates = %v, want only the 6th", series.ExDates)
+	}
+	if !override.RecurrenceID.Equal(time.Date(2026, time.March, 5, 18, 0, 0, 0, berlin)) ||
+		!override.Start.Equal(time.Date(2026, time.March, 5, 20, 0, 0, 0, berlin)) ||
+		override.End.Sub(override.Start) != 90*time.Minute {
+		t.Errorf("override = %+v", override)
+	}
+
+	// The rendered calendar reads back with the shifted instance and the
+	// skipped one applied
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, ical.Calendar{ProdID: "test", Events: events}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "EXDATE") != 1 {
+		t.Errorf("calendar has %d EXDATEs, want 1:\n%s", strings.Count(buf.String(), "EXDATE"), buf.String())
+	}
+	parsed, err := ical.Parse(&buf, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var starts []string
+	for _, event := range ical.ApplyOverrides(parsed) {
+		occurrences, err := event.Occurrences(now, time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range occurrences {
+			starts = append(starts, o.Start.In(berlin).Format("01-02 15:04"))
+		}
+	}
+	want := "03-01 18:00,03-02 18:00,03-03 18:00,03-04 18:00,03-07 18:00,03-05 20:00"
+	if strings.Join(starts, ",") != want {
+		t.Errorf("instances = %s, want %s", strings.Join(starts, ","), want)
+	}
+}
+
+func TestTimerEventsPaused(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	timer := db.Timing{ID: "t1", StartTime: "18:00", Duration: 60, IsDaily: true, Timezone: "UTC", Paused: true}
+	if events, err := timerEvents(timer, now); err != nil || events != nil {
+		t.Errorf("paused without resume = %v, %v; want no events", events, err)
+	}
+
+	resumeAt := now.AddDate(0, 0, 3)
+	timer.ResumeAt = &resumeAt
+	events, err := timerEvents(timer, now)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("paused with resume = %v, %v", events, err)
+	}
+	if want := time.Date(2026, time.March, 4, 18, 0, 0, 0, time.UTC); !events[0].Start.Equal(want) {
+		t.Errorf("start = %s, want %s", events[0].Start, want)
+	}
+}
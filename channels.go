@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// defaultCliqAPIBase is used unless CLIQ_API_BASE points elsewhere, e.g.
+	// at the EU data center or a local fake.
+	defaultCliqAPIBase = "https://cliq.zoho.com/api/v2"
+	// channelCacheTTL is how long a user's channel list is reused
+	channelCacheTTL = 10 * time.Minute
+	// maxChannelPages bounds the pages fetched from a paginated listing
+	maxChannelPages = 20
+)
+
+var cliqClient = &http.Client{Timeout: 30 * time.Second}
+
+// cliqAPIURL returns the URL of a Cliq REST API path such as "/channels".
+func cliqAPIURL(path string) string {
+	base := os.Getenv("CLIQ_API_BASE")
+	if base == "" {
+		base = defaultCliqAPIBase
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// cliqChannel is a channel or chat the user can mute. ID is the chat ID used
+// by the mute and unmute APIs.
+type cliqChannel struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	UniqueName  string `json:"unique_name,omitempty"`
+	Type        string `json:"type"`
+	MemberCount int    `json:"member_count"`
+}
+
+type channelCacheEntry struct {
+	channels  []cliqChannel
+	fetchedAt time.Time
+}
+
+var (
+	channelCache      = make(map[string]channelCacheEntry)
+	channelCacheMutex sync.Mutex
+)
+
+// userChannels returns the channels and chats of a user, cached for
+// channelCacheTTL unless refresh is set.
+func userChannels(email string, refresh bool) ([]cliqChannel, error) {
+	channelCacheMutex.Lock()
+	entry, ok := channelCache[email]
+	channelCacheMutex.Unlock()
+	if ok && !refresh && time.Since(entry.fetchedAt) < channelCacheTTL {
+		return entry.channels, nil
+	}
+
+	accessToken, err := refreshAccessToken(email)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := fetchCliqChannels(context.Background(), accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	channelCacheMutex.Lock()
+	channelCache[email] = channelCacheEntry{channels: channels, fetchedAt: time.Now()}
+	channelCacheMutex.Unlock()
+	return channels, nil
+}
+
+// fetchCliqChannels lists the joined channels and the chats of the token's
+// user. Chats that belong to a listed channel are left out.
+func fetchCliqChannels(ctx context.Context, accessToken string) ([]cliqChannel, error) {
+	var channels []cliqChannel
+	seen := make(map[string]bool)
+
+	next := ""
+	for page := 0; page < maxChannelPages; page++ {
+		query := url.Values{"joined": {"true"}, "limit": {"100"}}
+		if next != "" {
+			query.Set("next_token", next)
+		}
+		var resp struct {
+			Channels []struct {
+				ChatID           string `json:"chat_id"`
+				Name             string `json:"name"`
+				UniqueName       string `json:"unique_name"`
+				ParticipantCount int    `json:"participant_count"`
+			} `json:"channels"`
+			NextToken string `json:"next_token"`
+		}
+		if err := cliqGet(ctx, accessToken, "/channels?"+query.Encode(), &resp); err != nil {
+			return nil, err
+		}
+		for _, ch := range resp.Channels {
+			if ch.ChatID == "" || seen[ch.ChatID] {
+				continue
+			}
+			seen[ch.ChatID] = true
+			channels = append(channels, cliqChannel{
+				ID:          ch.ChatID,
+				Name:        ch.Name,
+				UniqueName:  ch.UniqueName,
+				Type:        "channel",
+				MemberCount: ch.ParticipantCount,
+			})
+		}
+		if next = resp.NextToken; next == "" {
+			break
+		}
+	}
+	if next != "" {
+		log.Printf("Channel listing has more than %d pages, ignoring the rest", maxChannelPages)
+	}
+
+	next = ""
+	for page := 0; page < maxChannelPages; page++ {
+		query := url.Values{"limit": {"100"}}
+		if next != "" {
+			query.Set("next_token", next)
+		}
+		var resp struct {
+			Chats []struct {
+				ChatID           string `json:"chat_id"`
+				Name             string `json:"name"`
+				ChatType         string `json:"chat_type"`
+				ParticipantCount int    `json:"participant_count"`
+			} `json:"chats"`
+			NextToken string `json:"next_token"`
+		}
+		if err := cliqGet(ctx, accessToken, "/chats?"+query.Encode(), &resp); err != nil {
+			return nil, err
+		}
+		for _, chat := range resp.Chats {
+			if chat.ChatID == "" || seen[chat.ChatID] {
+				continue
+			}
+			seen[chat.ChatID] = true
+			chatType := chat.ChatType
+			if chatType == "" {
+				chatType = "chat"
+			}
+			channels = append(channels, cliqChannel{
+				ID:          chat.ChatID,
+				Name:        chat.Name,
+				Type:        chatType,
+				MemberCount: chat.ParticipantCount,
+			})
+		}
+		if next = resp.NextToken; next == "" {
+			break
+		}
+	}
+	if next != "" {
+		log.Printf("Chat listing has more than %d pages, ignoring the rest", maxChannelPages)
+	}
+	return channels, nil
+}
+
+func cliqGet(ctx context.Context, accessToken string, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", cliqAPIURL(path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Zoho-oauthtoken "+accessToken)
+	resp, err := cliqClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to get %s: status %d, body: %s", path, resp.StatusCode, string(bodyBytes))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// cliqPost sends body as JSON to a Cliq API path.
+func cliqPost(ctx context.Context, accessToken string, path string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", cliqAPIURL(path), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Zoho-oauthtoken "+accessToken)
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := cliqClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to post to %s: status %d, body: %s", path, resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// resolveChannels resolves the channel references of a timer request in
+// place, see resolveChannelRefs.
+func (r *timerRequest) resolveChannels(email string) ([]fieldError, error) {
+	if r.Channels == nil {
+		return nil, nil
+	}
+	resolved, fields, err := resolveChannelRefs(email, *r.Channels)
+	if err != nil || len(fields) > 0 {
+		return fields, err
+	}
+	*r.Channels = resolved
+	return nil, nil
+}
+
+// resolveChannelRefs replaces references of the form "#unique-name" with
+// their chat IDs and checks that "group:<name>" references exist and that
+// patterns such as "#alerts-*" are well-formed. Other entries are taken as
+// chat IDs already. The channel list is only fetched if
+// there is a name to resolve.
+func resolveChannelRefs(email string, refs []string) ([]string, []fieldError, error) {
+	var channels []cliqChannel
+	var loaded bool
+	var fields []fieldError
+	resolved := make([]string, len(refs))
+	for i, ref := range refs {
+		field := "channels[" + strconv.Itoa(i) + "]"
+		if group, ok := strings.CutPrefix(ref, groupPrefix); ok {
+			if _, err := db.GetChannelGroup(email, group); err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) {
+					return nil, nil, err
+				}
+				fields = append(fields, fieldError{Field: field, Message: "no channel group named " + group})
+			}
+			resolved[i] = ref
+			continue
+		}
+		if isChannelPattern(ref) {
+			if _, err := path.Match(strings.TrimPrefix(ref, "#"), ""); err != nil {
+				fields = append(fields, fieldError{Field: field, Message: "is not a valid channel pattern"})
+			}
+			resolved[i] = ref
+			continue
+		}
+		name, ok := strings.CutPrefix(strings.TrimSpace(ref), "#")
+		if !ok {
+			resolved[i] = ref
+			continue
+		}
+		if !loaded {
+			var err error
+			if channels, err = userChannels(email, false); err != nil {
+				return nil, nil, err
+			}
+			loaded = true
+		}
+		id := ""
+		for _, ch := range channels {
+			if ch.UniqueName != "" && strings.EqualFold(ch.UniqueName, name) {
+				id = ch.ID
+				break
+			}
+		}
+		if id == "" {
+			fields = append(fields, fieldError{Field: field, Message: "no channel with unique name " + name})
+			continue
+		}
+		resolved[i] = id
+	}
+	if len(fields) > 0 {
+		return nil, fields, nil
+	}
+	return resolved, nil, nil
+}
+
+// isChannelPattern reports whether a channel reference is a wildcard
+// pattern over unique names, e.g. "#alerts-*" or "#ci-?".
+func isChannelPattern(ref string) bool {
+	return strings.HasPrefix(ref, "#") && strings.ContainsAny(ref, "*?[")
+}
+
+// matchChannels returns the chat IDs of the channels whose unique name, or
+// name if they have none, matches a pattern case-insensitively.
+func matchChannels(pattern string, channels []cliqChannel) []string {
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, "#"))
+	var ids []string
+	for _, ch := range channels {
+		name := ch.UniqueName
+		if name == "" {
+			name = strings.TrimPrefix(ch.Name, "#")
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			ids = append(ids, ch.ID)
+		}
+	}
+	return ids
+}
+
+// timerChannels returns the chat IDs a timer mutes: groups are expanded to
+// their current channels and patterns to the user's matching channels, so
+// both are picked up again at every job generation run. If Cliq can't be
+// reached, patterns are skipped and the other channels are still muted;
+// allowlist timers, which need the full channel list, fail instead.
+func timerChannels(email string, timer db.Timing) ([]string, error) {
+	var usesGroups, usesPatterns bool
+	for _, channel := range timer.Channels {
+		usesGroups = usesGroups || strings.HasPrefix(channel, groupPrefix)
+		usesPatterns = usesPatterns || isChannelPattern(channel)
+	}
+
+	var groups map[string][]string
+	if usesGroups {
+		var err error
+		if groups, err = channelGroups(email); err != nil {
+			return nil, err
+		}
+		for _, channel := range expandChannels(timer.Channels, groups) {
+			usesPatterns = usesPatterns || isChannelPattern(channel)
+		}
+	}
+
+	var available []cliqChannel
+	if usesPatterns || timer.Allowlist {
+		var err error
+		if available, err = userChannels(email, false); err != nil {
+			if timer.Allowlist {
+				return nil, fmt.Errorf("error listing channels for allowlist: %w", err)
+			}
+			log.Printf("Skipping channel patterns of timer %s for user %s: %v", timer.ID, email, err)
+		}
+	}
+	return mutedChannels(timer, groups, available), nil
+}
+
+// mutedChannels resolves the channels of a timer against the user's groups
+// and available channels. For allowlist timers it returns every available
+// channel the timer doesn't keep.
+func mutedChannels(timer db.Timing, groups map[string][]string, available []cliqChannel) []string {
+	var resolved []string
+	seen := make(map[string]bool)
+	for _, channel := range expandChannels(timer.Channels, groups) {
+		ids := []string{channel}
+		if isChannelPattern(channel) {
+			ids = matchChannels(channel, available)
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				resolved = append(resolved, id)
+			}
+		}
+	}
+	if !timer.Allowlist {
+		return resolved
+	}
+
+	var muted []string
+	for _, ch := range available {
+		if !seen[ch.ID] {
+			muted = append(muted, ch.ID)
+		}
+	}
+	return muted
+}
+
+// channelSummary describes the channels a timer mutes for display.
+func channelSummary(timer db.Timing) string {
+	channels := strings.Join(timer.Channels, ", ")
+	if !timer.Allowlist {
+		return channels
+	}
+	if channels == "" {
+		return "all channels"
+	}
+	return "all channels except " + channels
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// cliqUser is the user invoking a Cliq command or bot.
+type cliqUser struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Timezone  string `json:"timezone"`
+}
+
+// cliqMention is a channel mentioned in the command arguments.
+type cliqMention struct {
+	ID     string `json:"id"`
+	ChatID string `json:"chat_id"`
+	Name   string `json:"name"`
+}
+
+// cliqCommandRequest is the payload Cliq posts when a slash command is run:
+//
+//	{"name": "quiet", "arguments": "18:00 90m #general daily",
+//	 "user": {"email": "...", "timezone": "Asia/Kolkata"},
+//	 "mentions": {"channels": [{"name": "general", "chat_id": "CT_1234"}]}}
+type cliqCommandRequest struct {
+	Name      string   `json:"name"`
+	Arguments string   `json:"arguments"`
+	User      cliqUser `json:"user"`
+	Chat      struct {
+		ID    string `json:"id"`
+		Type  string `json:"type"`
+		Title string `json:"title"`
+	} `json:"chat"`
+	Mentions struct {
+		Channels []cliqMention `json:"channels"`
+	} `json:"mentions"`
+}
+
+// cliqMessage is a Cliq message reply, rendered as a card.
+type cliqMessage struct {
+	Text    string       `json:"text"`
+	Card    *cliqCard    `json:"card,omitempty"`
+	Slides  []cliqSlide  `json:"slides,omitempty"`
+	Buttons []cliqButton `json:"buttons,omitempty"`
+}
+
+type cliqCard struct {
+	Title string `json:"title"`
+	Theme string `json:"theme,omitempty"`
+}
+
+// cliqSlide is a block of a card; Data is text for "text" slides and a
+// cliqTable for "table" slides.
+type cliqSlide struct {
+	Type    string       `json:"type"`
+	Title   string       `json:"title,omitempty"`
+	Data    any          `json:"data"`
+	Buttons []cliqButton `json:"buttons,omitempty"`
+}
+
+// cliqButton invokes a function of the extension when clicked; Cliq passes
+// Key back in the callback.
+type cliqButton struct {
+	Label  string           `json:"label"`
+	Type   string           `json:"type"`
+	Key    string           `json:"key"`
+	Action cliqButtonAction `json:"action"`
+}
+
+type cliqButtonAction struct {
+	Type string            `json:"type"`
+	Data map[string]string `json:"data"`
+}
+
+type cliqTable struct {
+	Headers []string            `json:"headers"`
+	Rows    []map[string]string `json:"rows"`
+}
+
+// cliqReply builds a card message with a title and text.
+func cliqReply(title string, text string) cliqMessage {
+	return cliqMessage{Text: text, Card: &cliqCard{Title: title, Theme: "modern-inline"}}
+}
+
+// verifyCliqSignature checks the X-Cliq-Signature header, a base64 RSA
+// SHA-256 signature of the raw body, against the extension's public key in
+// CLIQ_PUBLIC_KEY. Cliq webhooks are disabled while it's unset.
+func verifyCliqSignature(c *fiber.Ctx) error {
+	key, err := cliqPublicKey()
+	if err != nil {
+		log.Printf("Rejecting Cliq request: %v", err)
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Cliq integration is not configured")
+	}
+	signature, err := base64.StdEncoding.DecodeString(c.Get("X-Cliq-Signature"))
+	if err != nil || len(signature) == 0 {
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Missing request signature")
+	}
+	digest := sha256.Sum256(c.Body())
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return sendError(c, fiber.StatusUnauthorized, "unauthorized", "Invalid request signature")
+	}
+	return c.Next()
+}
+
+// registerCliqRoutes mounts the endpoints the Cliq extension calls. They
+// act for the user named in the payload, which is only trustworthy because
+// every request must carry the extension's signature.
+func registerCliqRoutes(app *fiber.App) {
+	cliq := app.Group("/cliq", verifyCliqSignature)
+	cliq.Post("/commands/quiet", quietCommandHandler)
+	cliq.Post("/bot/messages", botMessageHandler)
+	cliq.Post("/bot/actions", botActionHandler)
+	cliq.Post("/bot/forms", botFormHandler)
+	cliq.Post("/messages", incomingMessageHandler)
+}
+
+// cliqPublicKey parses CLIQ_PUBLIC_KEY, either PEM or the bare base64 DER
+// shown in the Cliq extension settings.
+func cliqPublicKey() (*rsa.PublicKey, error) {
+	value := strings.TrimSpace(os.Getenv("CLIQ_PUBLIC_KEY"))
+	if value == "" {
+		return nil, fmt.Errorf("CLIQ_PUBLIC_KEY is not set")
+	}
+	var der []byte
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("CLIQ_PUBLIC_KEY is neither PEM nor base64: %w", err)
+		}
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CLIQ_PUBLIC_KEY: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("CLIQ_PUBLIC_KEY is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// cliqAccount maps the Cliq user to their AfterWork Buddy account by email.
+// If there is none, it returns the reply to send instead.
+func cliqAccount(cliqUser cliqUser) (string, *cliqMessage) {
+	user, err := db.User{}, mongo.ErrNoDocuments
+	if cliqUser.Email != "" {
+		user, err = db.GetUser(cliqUser.Email)
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			reply := cliqReply("Connect AfterWork Buddy", "Your Cliq account isn't connected yet. Sign in at "+hostUrl+"/redirect first.")
+			return "", &reply
+		}
+		log.Printf("Error loading Cliq user %s: %v", cliqUser.Email, err)
+		reply := cliqReply("Something went wrong", "Couldn't load your account, please try again.")
+		return "", &reply
+	}
+	if user.Disabled {
+		reply := cliqReply("Account disabled", "Your AfterWork Buddy account is disabled. Contact your administrator.")
+		return "", &reply
+	}
+	return user.Email, nil
+}
+
+// quietCommandHandler handles the /quiet slash command:
+//
+//	/quiet 18:00 90m #general #random daily
+//	/quiet 18:00 90m except #incidents daily
+//	/quiet list
+//	/quiet stop <id>
+func quietCommandHandler(c *fiber.Ctx) error {
+	var req cliqCommandRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+
+	email, failed := cliqAccount(req.User)
+	if failed != nil {
+		return c.JSON(failed)
+	}
+
+	args := strings.Fields(req.Arguments)
+	switch {
+	case len(args) == 0 || strings.EqualFold(args[0], "help"):
+		return c.JSON(quietUsage())
+	case strings.EqualFold(args[0], "list"):
+		return c.JSON(quietList(email))
+	case strings.EqualFold(args[0], "stop"):
+		if len(args) != 2 {
+			return c.JSON(cliqReply("Usage", "/quiet stop <id>"))
+		}
+		return c.JSON(quietStop(email, args[1]))
+	default:
+		return c.JSON(quietCreate(email, req, args))
+	}
+}
+
+func quietUsage() cliqMessage {
+	return cliqReply("/quiet", strings.Join([]string{
+		"/quiet 18:00 90m #general #random daily - mute channels from 18:00 for 90 minutes, every day",
+		"/quiet 18:00 90m except #incidents daily - mute everything but #incidents",
+		"/quiet list - show your timers",
+		"/quiet stop <id> - delete a timer",
+	}, "\n"))
+}
+
+func quietList(email string) cliqMessage {
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		log.Printf("Error getting timers for user %s: %v", email, err)
+		return cliqReply("Something went wrong", "Couldn't load your timers, please try again.")
+	}
+	if len(timers) == 0 {
+		return cliqReply("Your timers", "You have no timers. Create one with /quiet 18:00 90m #channel daily")
+	}
+
+	table := cliqTable{Headers: []string{"ID", "Start", "Duration", "Repeat", "Channels", "Status"}}
+	for _, timer := range timers {
+		repeat := "once"
+		if timer.IsDaily {
+			repeat = "daily"
+		}
+		status := "active"
+		if timer.Paused {
+			status = "paused"
+		}
+		table.Rows = append(table.Rows, map[string]string{
+			"ID":       timer.ID,
+			"Start":    timer.StartTime + " " + timer.Timezone,
+			"Duration": formatMinutes(timer.Duration),
+			"Repeat":   repeat,
+			"Channels": channelSummary(timer),
+			"Status":   status,
+		})
+	}
+	msg := cliqReply("Your timers", fmt.Sprintf("You have %d timer(s).", len(timers)))
+	msg.Slides = []cliqSlide{{Type: "table", Data: table}}
+	return msg
+}
+
+// quietStop deletes the timer with the given ID or unique ID prefix.
+func quietStop(email string, id string) cliqMessage {
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		log.Printf("Error getting timers for user %s: %v", email, err)
+		return cliqReply("Something went wrong", "Couldn't load your timers, please try again.")
+	}
+	var matches []db.Timing
+	for _, timer := range timers {
+		if timer.ID == id {
+			matches = []db.Timing{timer}
+			break
+		}
+		if strings.HasPrefix(timer.ID, id) {
+			matches = append(matches, timer)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return cliqReply("Timer not found", "You have no timer "+id+". See /quiet list.")
+	case len(matches) > 1:
+		return cliqReply("Ambiguous ID", id+" matches several timers, use more of the ID.")
+	}
+
+	if err := stopTimer(email, matches[0].ID); err != nil {
+		if errors.Is(err, errManagedTimer) {
+			return cliqReply("Managed timer", "That timer is set by a team policy; ask a team manager to change it.")
+		}
+		log.Printf("Error removing timer %s for user %s: %v", matches[0].ID, email, err)
+		return cliqReply("Something went wrong", "Couldn't stop the timer, please try again.")
+	}
+	return cliqReply("Timer stopped", "Deleted the timer starting at "+matches[0].StartTime+".")
+}
+
+// quietArgs are the parsed arguments of /quiet.
+type quietArgs struct {
+	startTime string
+	duration  int
+	isDaily   bool
+	allowlist bool
+	channels  []string // chat IDs of mentioned channels, other references as given
+	names     []string // the channels as typed, for the reply
+}
+
+// parseQuietArgs parses "<HH:MM> <duration> [except] <channels...> [daily]";
+// "except" makes the channels an allowlist. The values themselves are
+// checked by timerRequest.validate.
+func parseQuietArgs(args []string, mentions []cliqMention) (quietArgs, []string) {
+	var parsed quietArgs
+	var problems []string
+	for i, arg := range args {
+		switch {
+		case i == 0:
+			parsed.startTime = arg
+		case i == 1:
+			minutes, err := parseMinutes(arg)
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			parsed.duration = minutes
+		case strings.EqualFold(arg, "daily"):
+			parsed.isDaily = true
+		case strings.EqualFold(arg, "except"):
+			parsed.allowlist = true
+		default:
+			parsed.channels = append(parsed.channels, resolveMentionedChannel(arg, mentions))
+			parsed.names = append(parsed.names, arg)
+		}
+	}
+	if parsed.channels == nil {
+		parsed.channels = []string{}
+	}
+	return parsed, problems
+}
+
+// request returns the timer request for the arguments in a timezone.
+func (q quietArgs) request(timezone string) timerRequest {
+	return timerRequest{
+		StartTime: &q.startTime,
+		Duration:  &q.duration,
+		IsDaily:   &q.isDaily,
+		Timezone:  &timezone,
+		Channels:  &q.channels,
+		Allowlist: &q.allowlist,
+	}
+}
+
+// quietCreate creates a timer from the /quiet arguments in the Cliq user's
+// timezone.
+func quietCreate(email string, req cliqCommandRequest, args []string) cliqMessage {
+	parsed, problems := parseQuietArgs(args, req.Mentions.Channels)
+	timezone := req.User.Timezone
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+		timezone = defaultTimezone
+	}
+	timerReq := parsed.request(timezone)
+	if len(problems) == 0 {
+		for _, field := range timerReq.validate(false) {
+			problems = append(problems, field.Field+" "+field.Message)
+		}
+	}
+	if len(problems) == 0 {
+		fields, err := timerReq.resolveChannels(email)
+		if err != nil {
+			log.Printf("Error resolving channels for user %s: %v", email, err)
+			return cliqReply("Something went wrong", "Couldn't look up your channels in Cliq, please try again.")
+		}
+		for _, field := range fields {
+			problems = append(problems, field.Message)
+		}
+	}
+	if len(problems) > 0 {
+		msg := cliqReply("Couldn't create the timer", strings.Join(problems, "\n"))
+		msg.Slides = []cliqSlide{{Type: "text", Title: "Usage", Data: "/quiet 18:00 90m #general #random daily"}}
+		return msg
+	}
+
+	timer := db.Timing{ID: uuid.New().String()}
+	timerReq.apply(&timer)
+	scheduled, err := createTimer(email, timer)
+	if err != nil {
+		log.Printf("Error creating timer %s for user %s: %v", timer.ID, email, err)
+		return cliqReply("Something went wrong", "Couldn't save the timer, please try again.")
+	}
+	if !scheduled {
+		return cliqReply("Timer not scheduled", "The one-time timer starts in the past. Add \"daily\" to repeat it.")
+	}
+
+	repeat := "today"
+	if parsed.isDaily {
+		repeat = "every day"
+	}
+	muting := strings.Join(parsed.names, " ")
+	if parsed.allowlist {
+		muting = strings.TrimSuffix("everything except "+muting, " except ")
+	}
+	return cliqReply("Quiet time set", fmt.Sprintf("Muting %s at %s (%s) for %s, %s.\nID: %s",
+		muting, parsed.startTime, timezone, formatMinutes(parsed.duration), repeat, timer.ID))
+}
+
+// resolveMentionedChannel turns "#name" into the chat ID of the mentioned
+// channel. Other arguments, and names Cliq didn't send a mention for, are
+// left for timerRequest.resolveChannels.
+func resolveMentionedChannel(arg string, mentions []cliqMention) string {
+	name, ok := strings.CutPrefix(arg, "#")
+	if !ok {
+		return arg
+	}
+	for _, mention := range mentions {
+		if strings.EqualFold(mention.Name, name) {
+			if mention.ChatID != "" {
+				return mention.ChatID
+			}
+			return mention.ID
+		}
+	}
+	return arg
+}
+
+// parseMinutes parses a duration such as "90m", "1h30m", "2h" or "90".
+func parseMinutes(value string) (int, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d%time.Minute != 0 {
+		return 0, fmt.Errorf("duration %q must look like 90m or 1h30m", value)
+	}
+	return int(d / time.Minute), nil
+}
+
+// formatMinutes renders minutes as e.g. "1h30m", "2h" or "45m".
+func formatMinutes(minutes int) string {
+	switch {
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	default:
+		return fmt.Sprintf("%dh%dm", minutes/60, minutes%60)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseQuietArgs(t *testing.T) {
+	mentions := []cliqMention{
+		{Name: "general", ChatID: "CT_general"},
+		{Name: "incidents", ID: "CT_incidents"},
+	}
+	tests := []struct {
+		args     string
+		want     quietArgs
+		problems int
+		invalid  []string // fields timerRequest.validate rejects
+	}{
+		{
+			args: "18:00 90m #general #random daily",
+			want: quietArgs{startTime: "18:00", duration: 90, isDaily: true,
+				channels: []string{"CT_general", "#random"}, names: []string{"#general", "#random"}},
+		},
+		{
+			args: "18:00 1h30m except #Incidents DAILY",
+			want: quietArgs{startTime: "18:00", duration: 90, isDaily: true, allowlist: true,
+				channels: []string{"CT_incidents"}, names: []string{"#Incidents"}},
+		},
+		{
+			args: "07:30 45 CT_1 group:focus",
+			want: quietArgs{startTime: "07:30", duration: 45,
+				channels: []string{"CT_1", "group:focus"}, names: []string{"CT_1", "group:focus"}},
+		},
+		{
+			args: "18:00 2h except",
+			want: quietArgs{startTime: "18:00", duration: 120, allowlist: true, channels: []string{}},
+		},
+		{
+			args:     "18:00 soon #general",
+			want:     quietArgs{startTime: "18:00", channels: []string{"CT_general"}, names: []string{"#general"}},
+			problems: 1,
+		},
+		{
+			args:    "18:00 90m",
+			want:    quietArgs{startTime: "18:00", duration: 90, channels: []string{}},
+			invalid: []string{"channels"},
+		},
+		{
+			args:    "25:00 0m #general",
+			want:    quietArgs{startTime: "25:00", channels: []string{"CT_general"}, names: []string{"#general"}},
+			invalid: []string{"starttime", "duration"},
+		},
+		{
+			args:    "18:00 24h #general",
+			want:    quietArgs{startTime: "18:00", duration: 24 * 60, channels: []string{"CT_general"}, names: []string{"#general"}},
+			invalid: []string{"duration"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			got, problems := parseQuietArgs(strings.Fields(tt.args), mentions)
+			if len(problems) != tt.problems {
+				t.Errorf("problems = %v, want %d", problems, tt.problems)
+			}
+			if got.startTime != tt.want.startTime || got.duration != tt.want.duration ||
+				got.isDaily != tt.want.isDaily || got.allowlist != tt.want.allowlist ||
+				!slices.Equal(got.channels, tt.want.channels) || !slices.Equal(got.names, tt.want.names) {
+				t.Errorf("parseQuietArgs = %+v, want %+v", got, tt.want)
+			}
+			if problems != nil {
+				return
+			}
+
+			var invalid []string
+			for _, field := range got.request("Europe/Berlin").validate(false) {
+				invalid = append(invalid, field.Field)
+			}
+			if !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("invalid fields = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestParseMinutes(t *testing.T) {
+	for value, want := range map[string]int{"90": 90, "90m": 90, "1h30m": 90, "2h": 120} {
+		if got, err := parseMinutes(value); err != nil || got != want {
+			t.Errorf("parseMinutes(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "soon", "90s", "1.5m"} {
+		if _, err := parseMinutes(value); err == nil {
+			t.Errorf("parseMinutes(%q): expected an error", value)
+		}
+	}
+}
+
+// signingKey generates the extension's key pair and configures the server
+// with its public key.
+func signingKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLIQ_PUBLIC_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	return key
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, body string) string {
+	t.Helper()
+	digest := sha256.Sum256([]byte(body))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestVerifyCliqSignature(t *testing.T) {
+	key := signingKey(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Post("/cliq", verifyCliqSignature, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	const body = `{"name":"quiet","arguments":"list","user":{"email":"ana@example.com"}}`
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      int
+	}{
+		{"valid", body, sign(t, key, body), fiber.StatusNoContent},
+		{"tampered body", strings.Replace(body, "ana@", "bob@", 1), sign(t, key, body), fiber.StatusUnauthorized},
+		{"other key", body, sign(t, other, body), fiber.StatusUnauthorized},
+		{"missing", body, "", fiber.StatusUnauthorized},
+		{"not base64", body, "not a signature!", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/cliq", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if tt.signature != "" {
+				req.Header.Set("X-Cliq-Signature", tt.signature)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	t.Run("unconfigured", func(t *testing.T) {
+		t.Setenv("CLIQ_PUBLIC_KEY", "")
+		req := httptest.NewRequest(fiber.MethodPost, "/cliq", strings.NewReader(body))
+		req.Header.Set("X-Cliq-Signature", sign(t, key, body))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", resp.StatusCode)
+		}
+	})
+}
+
+func TestCliqPublicKeyFormats(t *testing.T) {
+	key := signingKey(t)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	t.Setenv("CLIQ_PUBLIC_KEY", base64.StdEncoding.EncodeToString(der))
+	parsed, err := cliqPublicKey()
+	if err != nil || !parsed.Equal(&key.PublicKey) {
+		t.Errorf("bare base64 key = %v, %v", parsed, err)
+	}
+
+	t.Setenv("CLIQ_PUBLIC_KEY", "not a key")
+	if _, err := cliqPublicKey(); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+// fakeCliq is an in-memory Cliq REST API. It serves pages of channels and
+// chats and records the chats muted and unmuted.
+type fakeCliq struct {
+	token    string
+	channels [][]map[string]any // pages of /channels
+	chats    [][]map[string]any // pages of /chats
+	// messages of each chat, newest first, as returned by
+	// /chats/{id}/messages between fromtime and totime
+	messages map[string][]cliqChatMessage
+
+	mu       sync.Mutex
+	requests []string
+	muted    []string
+	statuses []map[string]any
+}
+
+// serveFakeCliq starts the fake and points the Cliq API base at it.
+func serveFakeCliq(t *testing.T, fake *fakeCliq) *httptest.Server {
+	t.Helper()
+	if fake.token == "" {
+		fake.token = "test-token"
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("CLIQ_API_BASE", srv.URL+"/api/v2")
+	return srv
+}
+
+func (f *fakeCliq) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+	if r.Header.Get("Authorization") != "Zoho-oauthtoken "+f.token {
+		http.Error(w, `{"code":"oauthtoken_invalid"}`, http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2")
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && path == "/channels":
+		writePage(w, r, "channels", f.channels)
+	case r.Method == http.MethodGet && path == "/chats":
+		writePage(w, r, "chats", f.chats)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/messages"):
+		f.writeMessages(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/chats/"), "/messages"))
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/mute"):
+		f.muted = append(f.muted, strings.TrimSuffix(strings.TrimPrefix(path, "/chats/"), "/mute"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/unmute"):
+		chat := strings.TrimSuffix(strings.TrimPrefix(path, "/chats/"), "/unmute")
+		f.muted = slices.DeleteFunc(f.muted, func(id string) bool { return id == chat })
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && path == "/statuses":
+		var status map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			http.Error(w, `{"code":"invalid_json"}`, http.StatusBadRequest)
+			return
+		}
+		f.statuses = append(f.statuses, status)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"code":"not_found"}`, http.StatusNotFound)
+	}
+}
+
+// writePage writes the page of a listing selected by next_token, which is
+// the index of the page.
+func writePage(w http.ResponseWriter, r *http.Request, key string, pages [][]map[string]any) {
+	page := 0
+	if token := r.URL.Query().Get("next_token"); token != "" {
+		page = int(token[0] - '0')
+	}
+	resp := map[string]any{key: []map[string]any{}}
+	if page < len(pages) {
+		resp[key] = pages[page]
+	}
+	if page+1 < len(pages) {
+		resp["next_token"] = string(rune('0' + page + 1))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeMessages writes the newest messages of a chat sent between fromtime
+// and totime, both inclusive, up to limit.
+func (f *fakeCliq) writeMessages(w http.ResponseWriter, r *http.Request, chatID string) {
+	query := r.URL.Query()
+	from, err1 := strconv.ParseInt(query.Get("fromtime"), 10, 64)
+	to, err2 := strconv.ParseInt(query.Get("totime"), 10, 64)
+	limit, err3 := strconv.Atoi(query.Get("limit"))
+	if err1 != nil || err2 != nil || err3 != nil || limit > 100 {
+		http.Error(w, `{"code":"invalid_parameters"}`, http.StatusBadRequest)
+		return
+	}
+	messages, ok := f.messages[chatID]
+	if !ok {
+		http.Error(w, `{"code":"chat_not_found"}`, http.StatusNotFound)
+		return
+	}
+	data := []cliqChatMessage{}
+	for _, msg := range messages {
+		if msg.Time >= from && msg.Time <= to && len(data) < limit {
+			data = append(data, msg)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (f *fakeCliq) requested(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMuteChannelAgainstFakeCliq(t *testing.T) {
+	fake := &fakeCliq{}
+	serveFakeCliq(t, fake)
+	ctx := t.Context()
+
+	if err := muteChannel(ctx, fake.token, "CT_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := muteChannel(ctx, fake.token, "CT_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmuteChannel(ctx, fake.token, "CT_1"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fake.muted, []string{"CT_2"}) {
+		t.Errorf("muted = %v, want [CT_2]", fake.muted)
+	}
+	if err := muteChannel(ctx, "expired", "CT_3"); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("mute with a bad token = %v, want a 401 error", err)
+	}
+}
+
+func TestFetchCliqChannels(t *testing.T) {
+	fake := &fakeCliq{
+		channels: [][]map[string]any{
+			{{"chat_id": "CT_1", "name": "#general", "unique_name": "general", "participant_count": 40}},
+			{{"chat_id": "CT_2", "name": "#alerts", "unique_name": "alerts"}, {"chat_id": "CT_1", "name": "#general"}},
+		},
+		chats: [][]map[string]any{
+			{{"chat_id": "CT_2", "name": "#alerts", "chat_type": "channel"}, {"chat_id": "DM_1", "name": "Bob"}},
+			{{"chat_id": "GR_1", "name": "Launch", "chat_type": "group"}},
+			{{"chat_id": "DM_2", "name": "Carol"}},
+		},
+	}
+	serveFakeCliq(t, fake)
+
+	channels, err := fetchCliqChannels(t.Context(), fake.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, ch := range channels {
+		ids = append(ids, ch.ID+":"+ch.Type)
+	}
+	// Chats beyond the first page are listed too, so allowlist timers mute them
+	if want := []string{"CT_1:channel", "CT_2:channel", "DM_1:chat", "GR_1:group", "DM_2:chat"}; !slices.Equal(ids, want) {
+		t.Errorf("channels = %v, want %v", ids, want)
+	}
+	if n := fake.requested("GET /api/v2/channels"); n != 2 {
+		t.Errorf("fetched %d channel pages, want 2", n)
+	}
+	if n := fake.requested("GET /api/v2/chats"); n != 3 {
+		t.Errorf("fetched %d chat pages, want 3", n)
+	}
+
+	if _, err := fetchCliqChannels(t.Context(), "expired"); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+}
+
+func TestCliqStatusAgainstFakeCliq(t *testing.T) {
+	fake := &fakeCliq{}
+	serveFakeCliq(t, fake)
+
+	if err := setCliqStatus(t.Context(), fake.token, cliqStatus{Code: "busy", Message: "Focusing until 18:00"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.statuses) != 1 || fake.statuses[0]["code"] != "busy" || fake.statuses[0]["message"] != "Focusing until 18:00" {
+		t.Errorf("statuses = %v", fake.statuses)
+	}
+	if err := setCliqStatus(t.Context(), "expired", cliqStatus{Code: "busy"}); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("set status with a bad token = %v, want a 401 error", err)
+	}
+}
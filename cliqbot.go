@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// cliqActionFunction and cliqFormFunction are the extension functions
+	// forwarding button clicks and form submissions to /cliq/bot/actions and
+	// /cliq/bot/forms.
+	cliqActionFunction = "afterworkTimerAction"
+	cliqFormFunction   = "afterworkTimerForm"
+)
+
+// cliqBotMessage is the payload Cliq posts when a user messages the bot.
+type cliqBotMessage struct {
+	Message string   `json:"message"`
+	User    cliqUser `json:"user"`
+}
+
+// cliqButtonClick is the payload of a button callback; Target.Key is the
+// "<action>:<timer id>" key of the clicked button.
+type cliqButtonClick struct {
+	User   cliqUser `json:"user"`
+	Target struct {
+		Key   string `json:"key"`
+		Label string `json:"label"`
+	} `json:"target"`
+}
+
+// cliqFormSubmit is the payload of a submitted form; Form.Name is
+// "edit:<timer id>".
+type cliqFormSubmit struct {
+	User cliqUser `json:"user"`
+	Form struct {
+		Name   string            `json:"name"`
+		Values map[string]string `json:"values"`
+	} `json:"form"`
+}
+
+// cliqForm is a form reply, shown to the user as a dialog.
+type cliqForm struct {
+	Type        string          `json:"type"`
+	Title       string          `json:"title"`
+	Name        string          `json:"name"`
+	ButtonLabel string          `json:"button_label"`
+	Inputs      []cliqFormInput `json:"inputs"`
+	Action      struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"action"`
+}
+
+type cliqFormInput struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Label     string `json:"label"`
+	Hint      string `json:"hint,omitempty"`
+	Value     string `json:"value"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+// botMessageHandler replies to any message sent to the bot with the card of
+// the user's timers.
+func botMessageHandler(c *fiber.Ctx) error {
+	var req cliqBotMessage
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	email, failed := cliqAccount(req.User)
+	if failed != nil {
+		return c.JSON(failed)
+	}
+	return c.JSON(timersCard(email, ""))
+}
+
+// timersCard lists the timers of a user, each with buttons to pause or
+// resume, skip tonight, edit and delete it. note is shown above the list.
+func timersCard(email string, note string) cliqMessage {
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		log.Printf("Error getting timers for user %s: %v", email, err)
+		return cliqReply("Something went wrong", "Couldn't load your timers, please try again.")
+	}
+	if len(timers) == 0 {
+		return cliqReply("Your timers", strings.TrimSpace(note+"\nYou have no timers. Create one with /quiet 18:00 90m #channel daily"))
+	}
+
+	msg := cliqReply("Your timers", strings.TrimSpace(note+"\n"+fmt.Sprintf("You have %d timer(s).", len(timers))))
+	now := time.Now()
+	for _, timer := range timers {
+		repeat := "once"
+		if timer.IsDaily {
+			repeat = "daily"
+		}
+		status := "Next: none"
+		if timer.Paused {
+			status = "Paused"
+		} else if muteAt, _, ok, err := nextWindow(withHolidaySkips(email, timer), now); err == nil && ok {
+			status = "Next: " + muteAt.Format("Mon 2 Jan 15:04 MST")
+		}
+
+		pause := timerButton("Pause", "+", "pause", timer.ID)
+		if timer.Paused {
+			pause = timerButton("Resume", "+", "resume", timer.ID)
+		}
+		msg.Slides = append(msg.Slides, cliqSlide{
+			Type:  "text",
+			Title: fmt.Sprintf("%s %s for %s, %s", timer.StartTime, timer.Timezone, formatMinutes(timer.Duration), repeat),
+			Data:  fmt.Sprintf("Channels: %s\n%s", channelSummary(timer), status),
+			Buttons: []cliqButton{
+				pause,
+				timerButton("Skip tonight", "+", "skip", timer.ID),
+				timerButton("Edit", "+", "edit", timer.ID),
+				timerButton("Delete", "-", "delete", timer.ID),
+			},
+		})
+	}
+	return msg
+}
+
+func timerButton(label string, style string, action string, timerID string) cliqButton {
+	return cliqButton{
+		Label: label,
+		Type:  style,
+		Key:   action + ":" + timerID,
+		Action: cliqButtonAction{
+			Type: "invoke.function",
+			Data: map[string]string{"name": cliqActionFunction},
+		},
+	}
+}
+
+// botActionHandler handles the buttons of the timers card and replies with
+// the updated card, or with the edit form.
+func botActionHandler(c *fiber.Ctx) error {
+	var req cliqButtonClick
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	action, timerID, ok := strings.Cut(req.Target.Key, ":")
+	if !ok || timerID == "" {
+		return sendValidationError(c, []fieldError{{Field: "target.key", Message: "must be <action>:<timer id>"}})
+	}
+
+	email, failed := cliqAccount(req.User)
+	if failed != nil {
+		return c.JSON(failed)
+	}
+
+	var note string
+	var err error
+	switch action {
+	case "edit":
+		form, err := editTimerForm(email, timerID)
+		if err != nil {
+			return c.JSON(timersCard(email, timerActionError(timerID, err)))
+		}
+		return c.JSON(form)
+	case "pause":
+		_, err = pauseTimer(email, timerID, nil)
+		note = "Timer paused."
+	case "resume":
+		_, err = resumeTimer(email, timerID)
+		note = "Timer resumed."
+	case "skip":
+		note, err = skipTonight(email, timerID)
+	case "delete":
+		err = stopTimer(email, timerID)
+		note = "Timer deleted."
+	default:
+		return c.JSON(cliqReply("Unknown action", "This button isn't supported anymore."))
+	}
+	if err != nil {
+		note = timerActionError(timerID, err)
+	}
+	return c.JSON(timersCard(email, note))
+}
+
+// timerActionError logs a failed button action and describes it to the user.
+func timerActionError(timerID string, err error) string {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "That timer doesn't exist anymore."
+	}
+	if errors.Is(err, errManagedTimer) {
+		return "That timer is set by a team policy and can't be changed here."
+	}
+	log.Printf("Error handling Cliq action on timer %s: %v", timerID, err)
+	return "Something went wrong, please try again."
+}
+
+// skipTonight adds a skip exception for today's window of a timer if it
+// hasn't started yet.
+func skipTonight(email string, timerID string) (string, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return "", err
+	}
+	loc, err := timerLocation(timer)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().In(loc)
+	muteAt, _, ok, err := nextWindow(withHolidaySkips(email, timer), now)
+	if err != nil {
+		return "", err
+	}
+	today := now.Format("2006-01-02")
+	switch {
+	case !ok || muteAt.Format("2006-01-02") != today:
+		return "There's no window left tonight.", nil
+	case !muteAt.After(now):
+		return "Tonight's window has already started; pause the timer to unmute now.", nil
+	}
+
+	if _, err := addTimerException(email, timerID, db.TimerException{Date: today, Skip: true}); err != nil {
+		return "", err
+	}
+	return "Skipping tonight's window.", nil
+}
+
+// editTimerForm builds the form to change a timer's start, duration and
+// channels.
+func editTimerForm(email string, timerID string) (cliqForm, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return cliqForm{}, err
+	}
+	channelsLabel := "Channels"
+	if timer.Allowlist {
+		channelsLabel = "Channels kept unmuted"
+	}
+	form := cliqForm{
+		Type:        "form",
+		Title:       "Edit timer",
+		Name:        "edit:" + timer.ID,
+		ButtonLabel: "Save",
+		Inputs: []cliqFormInput{
+			{Type: "text", Name: "starttime", Label: "Start", Hint: "HH:MM in " + timer.Timezone, Value: timer.StartTime, Mandatory: true},
+			{Type: "text", Name: "duration", Label: "Duration", Hint: "e.g. 90m or 1h30m", Value: formatMinutes(timer.Duration), Mandatory: true},
+			{Type: "text", Name: "channels", Label: channelsLabel, Hint: "Chat IDs, #unique-names, #patterns like #alerts-* or group:<name>; leave empty to keep them", Value: strings.Join(timer.Channels, ", ")},
+		},
+	}
+	form.Action.Type = "invoke.function"
+	form.Action.Name = cliqFormFunction
+	return form, nil
+}
+
+// botFormHandler applies a submitted edit form through the same update as
+// PATCH /timers/:id.
+func botFormHandler(c *fiber.Ctx) error {
+	var req cliqFormSubmit
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	timerID, ok := strings.CutPrefix(req.Form.Name, "edit:")
+	if !ok || timerID == "" {
+		return sendValidationError(c, []fieldError{{Field: "form.name", Message: "must be edit:<timer id>"}})
+	}
+
+	email, failed := cliqAccount(req.User)
+	if failed != nil {
+		return c.JSON(failed)
+	}
+
+	timerReq, problems := editFormRequest(req.Form.Values)
+	if len(problems) == 0 {
+		fields, err := timerReq.resolveChannels(email)
+		if err != nil {
+			log.Printf("Error resolving channels for user %s: %v", email, err)
+			return c.JSON(timersCard(email, "Couldn't look up your channels in Cliq, please try again."))
+		}
+		for _, field := range fields {
+			problems = append(problems, field.Message)
+		}
+	}
+	if len(problems) > 0 {
+		return c.JSON(timersCard(email, "Couldn't update the timer: "+strings.Join(problems, "; ")))
+	}
+
+	if _, err := updateTimer(email, timerID, timerReq); err != nil {
+		return c.JSON(timersCard(email, timerActionError(timerID, err)))
+	}
+	return c.JSON(timersCard(email, "Timer updated."))
+}
+
+// editFormRequest turns the values of a submitted edit form into a partial
+// timer update.
+func editFormRequest(values map[string]string) (timerRequest, []string) {
+	var timerReq timerRequest
+	var problems []string
+	if v, ok := values["starttime"]; ok {
+		v = strings.TrimSpace(v)
+		timerReq.StartTime = &v
+	}
+	if v, ok := values["duration"]; ok {
+		minutes, err := parseMinutes(strings.TrimSpace(v))
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		timerReq.Duration = &minutes
+	}
+	// An empty channels field leaves the channels unchanged, as allowlist
+	// timers may have none
+	if channels := strings.FieldsFunc(values["channels"], func(r rune) bool { return r == ',' || r == ' ' }); len(channels) > 0 {
+		timerReq.Channels = &channels
+	}
+	if len(problems) == 0 {
+		for _, field := range timerReq.validate(true) {
+			problems = append(problems, field.Field+" "+field.Message)
+		}
+	}
+	return timerReq, problems
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditFormRequest(t *testing.T) {
+	req, problems := editFormRequest(map[string]string{"starttime": " 19:00 ", "duration": "1h", "channels": "CT_1, #alerts-*"})
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	if *req.StartTime != "19:00" || *req.Duration != 60 || !slices.Equal(*req.Channels, []string{"CT_1", "#alerts-*"}) {
+		t.Errorf("request = %s %d %v", *req.StartTime, *req.Duration, *req.Channels)
+	}
+
+	// Allowlist timers without channels submit the field empty
+	for _, channels := range []string{"", " , "} {
+		req, problems := editFormRequest(map[string]string{"starttime": "19:00", "duration": "90m", "channels": channels})
+		if len(problems) > 0 || req.Channels != nil {
+			t.Errorf("channels %q: problems %v, channels %v; want them unchanged", channels, problems, req.Channels)
+		}
+	}
+
+	if _, problems := editFormRequest(map[string]string{"starttime": "7pm", "duration": "soon"}); len(problems) != 1 {
+		t.Errorf("problems = %v, want the duration's", problems)
+	}
+	if _, problems := editFormRequest(map[string]string{"starttime": "7pm", "duration": "90m"}); len(problems) != 1 {
+		t.Errorf("problems = %v, want the start time's", problems)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// AuditEntry records a privileged operation.
+type AuditEntry struct {
+	Actor  string    `json:"actor"  bson:"actor"`
+	Action string    `json:"action" bson:"action"`
+	Target string    `json:"target" bson:"target"`
+	At     time.Time `json:"at"     bson:"at"`
+}
+
+// ------------------- AUDIT FUNCTIONS -------------------
+
+// AddAuditEntry appends an entry to the audit log.
+func AddAuditEntry(entry AuditEntry) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("audit_log")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, entry)
+	return err
+}
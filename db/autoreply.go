@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// AutoReply configures the reply sent to people who DM a user during one of
+// their quiet windows. "{end}" in Message is replaced by the window's end
+// time in the sender's timezone.
+type AutoReply struct {
+	Message string `json:"message" bson:"message"`
+}
+
+// ------------------- AUTO-REPLY FUNCTIONS -------------------
+
+// SetAutoReply stores the auto-reply settings of a user; nil turns the
+// auto-reply off.
+func SetAutoReply(email string, settings *AutoReply) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"auto_reply": settings}}
+	if settings == nil {
+		update = bson.M{"$unset": bson.M{"auto_reply": ""}}
+	}
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RecordAutoReply notes that the sender got the auto-reply of a window. It
+// reports false if they already got it.
+func RecordAutoReply(email string, windowID string, senderID string) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("auto_replies")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, bson.M{
+		"_id":       email + "/" + windowID + "/" + senderID,
+		"email":     email,
+		"sender_id": senderID,
+		"at":        time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
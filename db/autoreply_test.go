@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// connectTestDB connects to the disposable MongoDB in TEST_MONGO_URI; tests
+// that need a database are skipped without one.
+func connectTestDB(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+	t.Setenv("MONGO_URI", uri)
+	Connect()
+	t.Cleanup(func() {
+		Disconnect()
+		client = nil
+	})
+}
+
+func TestRecordAutoReply(t *testing.T) {
+	connectTestDB(t)
+	email := "autoreply-test-" + time.Now().Format("150405.000000") + "@example.com"
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Database("afterwork").Collection("auto_replies").DeleteMany(ctx, bson.M{"email": email})
+	})
+
+	tests := []struct {
+		window, sender string
+		first          bool
+	}{
+		{"t1-202603021800", "bob", true},
+		{"t1-202603021800", "bob", false},
+		{"t1-202603021800", "carol", true},
+		{"t1-202603031800", "bob", true},
+		{"t1-202603031800", "bob", false},
+	}
+	for _, tt := range tests {
+		first, err := RecordAutoReply(email, tt.window, tt.sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != tt.first {
+			t.Errorf("RecordAutoReply(%s, %s) = %t, want %t", tt.window, tt.sender, first, tt.first)
+		}
+	}
+}
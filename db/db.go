@@ -20,11 +20,13 @@ var client *mongo.Client
 type Job struct {
 	ID        string    `json:"id"        bson:"_id"`
 	Email     string    `json:"email"     bson:"email"`
-	TaskType  string    `json:"task_type" bson:"task_type"` // "MUTE" or "UNMUTE"
+	TaskType  string    `json:"task_type" bson:"task_type"` // "MUTE", "UNMUTE", "SET_STATUS" or "RESTORE_STATUS"
 	ChannelID string    `json:"channel_id" bson:"channel_id"`
 	ExecuteAt time.Time `json:"execute_at" bson:"execute_at"`
-	Status    string    `json:"status"    bson:"status"` // "PENDING", "COMPLETE"
+	Status    string    `json:"status"    bson:"status"` // "PENDING", "COMPLETE" or "FAILED"
 	TimerID   string    `json:"timer_id"  bson:"timer_id"`
+	// Payload holds action parameters, e.g. the status message to set
+	Payload map[string]string `json:"payload,omitempty" bson:"payload,omitempty"`
 }
 
 type Timing struct {
@@ -32,7 +34,45 @@ type Timing struct {
 	StartTime string   `json:"starttime" bson:"starttime"`
 	Duration  int      `json:"duration"  bson:"duration"`
 	IsDaily   bool     `json:"isdaily"   bson:"isdaily"`
+	Timezone  string   `json:"timezone"  bson:"timezone"`
 	Channels  []string `json:"channels"  bson:"channels"`
+	// Allowlist timers mute every channel and chat of the user except Channels
+	Allowlist bool `json:"allowlist,omitempty" bson:"allowlist,omitempty"`
+	// Paused timers keep their configuration but generate no jobs until resumed,
+	// either explicitly or automatically at ResumeAt.
+	Paused   bool       `json:"paused"              bson:"paused"`
+	PausedAt *time.Time `json:"paused_at,omitempty" bson:"paused_at,omitempty"`
+	ResumeAt *time.Time `json:"resume_at,omitempty" bson:"resume_at,omitempty"`
+	// Exceptions override single occurrences of the timer
+	Exceptions []TimerException `json:"exceptions,omitempty" bson:"exceptions,omitempty"`
+	// Status, if set, is applied to the user's Cliq status for each window
+	Status *TimerStatus `json:"status,omitempty" bson:"status,omitempty"`
+	// Digest sends a summary of the muted channels after each window
+	Digest bool `json:"digest,omitempty" bson:"digest,omitempty"`
+	// Urgent lets matching messages in muted channels through to the user
+	Urgent *UrgentRules `json:"urgent,omitempty" bson:"urgent,omitempty"`
+	// Actions, if set, are the job types each window runs instead of every
+	// type the timer's settings produce, e.g. only SET_STATUS and
+	// RESTORE_STATUS for a timer that sets a status without muting
+	Actions []string `json:"actions,omitempty" bson:"actions,omitempty"`
+	// Policy is set on timers generated from a team policy, which only the
+	// team's managers can change
+	Policy *TimerPolicy `json:"policy,omitempty" bson:"policy,omitempty"`
+}
+
+// TimerException skips or shifts the occurrence of a timer on one date.
+type TimerException struct {
+	Date      string `json:"date"                bson:"date"` // "2006-01-02" in the timer's timezone
+	Skip      bool   `json:"skip"                bson:"skip"`
+	StartTime string `json:"starttime,omitempty" bson:"starttime,omitempty"`
+	Duration  int    `json:"duration,omitempty"  bson:"duration,omitempty"`
+}
+
+// TimerStatus is the Cliq status set while a timer's window runs. "{end}"
+// in Message is replaced with the local time the window ends.
+type TimerStatus struct {
+	Message  string `json:"message,omitempty"  bson:"message,omitempty"`
+	Presence string `json:"presence,omitempty" bson:"presence,omitempty"` // "available", "busy", "away" or "invisible"
 }
 
 type User struct {
@@ -40,6 +80,33 @@ type User struct {
 	RefreshToken string   `json:"refresh_token" bson:"refresh_token"`
 	State        string   `json:"state"         bson:"state"`
 	Timers       []Timing `json:"timers"        bson:"timers"`
+	// Holidays configures all-day muting on the dates of a holiday calendar
+	Holidays *HolidaySettings `json:"holidays,omitempty" bson:"holidays,omitempty"`
+	// FeedTokenHash is the SHA-256 of the secret token of the user's
+	// exported calendar feed
+	FeedTokenHash string `json:"-" bson:"feed_token_hash,omitempty"`
+	// APIKeyHash is the SHA-256 of the API key issued after OAuth
+	APIKeyHash string `json:"-" bson:"api_key_hash,omitempty"`
+	// TokenHealth is the outcome of the latest Zoho token refresh
+	TokenHealth *TokenHealth `json:"token_health,omitempty" bson:"token_health,omitempty"`
+	// AutoReply turns on replies to DMs received during quiet windows
+	AutoReply *AutoReply `json:"auto_reply,omitempty" bson:"auto_reply,omitempty"`
+	// Role is "admin", "team-manager" or "member"; empty means member
+	Role string `json:"role,omitempty" bson:"role,omitempty"`
+	// Disabled accounts can't use the API and their jobs don't run
+	Disabled   bool       `json:"disabled,omitempty"    bson:"disabled,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty" bson:"disabled_at,omitempty"`
+}
+
+// TokenHealth describes the state of a user's Zoho OAuth token without
+// containing the token. LastError is kept after later successful refreshes.
+type TokenHealth struct {
+	Valid         bool       `json:"valid"                     bson:"valid"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"      bson:"expires_at,omitempty"`
+	Scopes        []string   `json:"scopes"                    bson:"scopes"`
+	LastRefreshAt *time.Time `json:"last_refresh_at,omitempty" bson:"last_refresh_at,omitempty"`
+	LastError     string     `json:"last_refresh_error"        bson:"last_error"`
+	LastErrorAt   *time.Time `json:"last_refresh_error_at,omitempty" bson:"last_error_at,omitempty"`
 }
 
 // ------------------- CONNECTION -------------------
@@ -122,6 +189,11 @@ func GetAllUsers() ([]User, error) {
 	return users, nil
 }
 
+// GetUser retrieves a user by email.
+func GetUser(email string) (User, error) {
+	return GetRefreshToken(email)
+}
+
 func GetRefreshToken(email string) (User, error) {
 	var user User
 
@@ -141,6 +213,156 @@ func GetRefreshToken(email string) (User, error) {
 	return user, nil
 }
 
+// SetFeedTokenHash stores the hash of the user's calendar feed token,
+// replacing any previous one.
+func SetFeedTokenHash(email string, hash string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"feed_token_hash": hash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetUserByFeedTokenHash retrieves the user owning a calendar feed token.
+func GetUserByFeedTokenHash(hash string) (User, error) {
+	var user User
+	if client == nil {
+		return user, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"feed_token_hash": hash}).Decode(&user)
+	return user, err
+}
+
+// SetTokenHealth stores the outcome of a token refresh of the user.
+func SetTokenHealth(email string, health TokenHealth) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"token_health": health}})
+	return err
+}
+
+// SetAPIKeyHash stores the hash of the user's API key, revoking any previous key.
+func SetAPIKeyHash(email string, hash string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"api_key_hash": hash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetUserRole changes the role of a user.
+func SetUserRole(email string, role string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetUserDisabled disables or re-enables a user's account.
+func SetUserDisabled(email string, disabled bool) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"disabled": true, "disabled_at": time.Now()}}
+	if !disabled {
+		update = bson.M{"$unset": bson.M{"disabled": "", "disabled_at": ""}}
+	}
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FindUsers returns a page of users ordered by email, along with the total
+// number of users.
+func FindUsers(skip int64, limit int64) ([]User, int64, error) {
+	var users []User
+	if client == nil {
+		return nil, 0, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	total, err := collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "email", Value: 1}}).SetSkip(skip).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetUserByAPIKeyHash retrieves the user owning an API key.
+func GetUserByAPIKeyHash(hash string) (User, error) {
+	var user User
+	if client == nil {
+		return user, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"api_key_hash": hash}).Decode(&user)
+	return user, err
+}
+
 // ------------------- TIMER FUNCTIONS -------------------
 
 func SaveTimer(email string, timer Timing) error {
@@ -163,12 +385,12 @@ func SaveTimer(email string, timer Timing) error {
 	return err
 }
 
-// RemoveTimer now also removes associated jobs
+// RemoveTimer removes a timer from the user. Its jobs are kept; the caller
+// cancels the pending ones.
 func RemoveTimer(email string, timerID string) error {
 	if client == nil {
 		return fmt.Errorf("database not connected")
 	}
-	// First, remove the timer from the user's array
 	collection := client.Database("afterwork").Collection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -178,17 +400,44 @@ func RemoveTimer(email string, timerID string) error {
 	if err != nil {
 		return fmt.Errorf("failed to remove timer from user: %w", err)
 	}
+	return nil
+}
 
-	// Second, remove all pending jobs associated with this timer
-	if err := RemoveJobsForTimer(timerID); err != nil {
-		// Log this error but don't fail the whole operation,
-		// as the user-facing timer is already gone.
-		fmt.Printf("Warning: failed to remove pending jobs for timer %s: %v\n", timerID, err)
+// UpdateTimer replaces the stored timer with the same ID in a single update,
+// returning mongo.ErrNoDocuments if the user has no such timer.
+func UpdateTimer(email string, timer Timing) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
 	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
+	update := bson.M{"$set": bson.M{"timers.$": timer}}
+	res, err := collection.UpdateOne(ctx, bson.M{"email": email, "timers.id": timer.ID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 	return nil
 }
 
+// GetTimer returns a single timer of the user, or mongo.ErrNoDocuments.
+func GetTimer(email string, timerID string) (Timing, error) {
+	timers, err := GetTimers(email)
+	if err != nil {
+		return Timing{}, err
+	}
+	for _, timer := range timers {
+		if timer.ID == timerID {
+			return timer, nil
+		}
+	}
+	return Timing{}, mongo.ErrNoDocuments
+}
+
 func GetTimers(email string) ([]Timing, error) {
 	var user User
 	if client == nil {
@@ -241,29 +490,200 @@ func GetPendingJobs() ([]Job, error) {
 	return jobs, nil
 }
 
-// CompleteJob marks a job's status as "COMPLETE".
-func CompleteJob(jobID string) error {
+// GetJob retrieves a single job by its ID.
+func GetJob(jobID string) (Job, error) {
+	var job Job
+	if client == nil {
+		return job, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": jobID}).Decode(&job)
+	return job, err
+}
+
+// GetPendingJobsForTimer retrieves the "PENDING" jobs generated by a timer.
+func GetPendingJobsForTimer(timerID string) ([]Job, error) {
+	var jobs []Job
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"timer_id": timerID, "status": "PENDING"})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// JobFilter narrows down the jobs returned by FindJobs. Zero values are ignored.
+type JobFilter struct {
+	Email     string
+	Status    string
+	TimerID   string
+	ChannelID string
+	From      time.Time
+	To        time.Time
+	Skip      int64
+	Limit     int64
+}
+
+// FindJobs returns a page of jobs matching the filter ordered by execution
+// time, along with the total number of matches.
+func FindJobs(filter JobFilter) ([]Job, int64, error) {
+	var jobs []Job
+	if client == nil {
+		return nil, 0, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.Email != "" {
+		query["email"] = filter.Email
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.TimerID != "" {
+		query["timer_id"] = filter.TimerID
+	}
+	if filter.ChannelID != "" {
+		query["channel_id"] = filter.ChannelID
+	}
+	executeAt := bson.M{}
+	if !filter.From.IsZero() {
+		executeAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		executeAt["$lte"] = filter.To
+	}
+	if len(executeAt) > 0 {
+		query["execute_at"] = executeAt
+	}
+
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "execute_at", Value: 1}}).SetSkip(filter.Skip)
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// RemoveJobs deletes the jobs with the given IDs.
+func RemoveJobs(jobIDs []string) error {
 	if client == nil {
 		return fmt.Errorf("database not connected")
 	}
+	if len(jobIDs) == 0 {
+		return nil
+	}
 	collection := client.Database("afterwork").Collection("jobs")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{"$set": bson.M{"status": "COMPLETE"}}
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": jobID}, update)
+	_, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": jobIDs}})
 	return err
 }
 
-// RemoveJobsForTimer deletes all jobs associated with a given timerID.
-func RemoveJobsForTimer(timerID string) error {
+// RemoveUserJobs deletes jobs of a user by ID. Jobs of other users are left
+// alone even if their ID is listed.
+func RemoveUserJobs(email string, jobIDs []string) error {
 	if client == nil {
 		return fmt.Errorf("database not connected")
 	}
+	if len(jobIDs) == 0 {
+		return nil
+	}
 	collection := client.Database("afterwork").Collection("jobs")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := collection.DeleteMany(ctx, bson.M{"timer_id": timerID})
+	_, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": jobIDs}, "email": email})
 	return err
 }
+
+// CompleteJob marks a job's status as "COMPLETE", returning
+// mongo.ErrNoDocuments if the job no longer exists.
+func CompleteJob(jobID string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": "COMPLETE"}}
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": jobID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FailJob marks a job's status as "FAILED" so that it isn't run again,
+// returning mongo.ErrNoDocuments if the job no longer exists.
+func FailJob(jobID string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": "FAILED"}}
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": jobID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetJobPayload replaces the payload of a job.
+func SetJobPayload(jobID string, payload map[string]string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("jobs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": jobID}, bson.M{"$set": bson.M{"payload": payload}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
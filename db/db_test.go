@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRemoveUserJobs(t *testing.T) {
+	connectTestDB(t)
+	suffix := time.Now().Format("150405.000000")
+	ana, bob := "ana-"+suffix+"@example.com", "bob-"+suffix+"@example.com"
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Database("afterwork").Collection("jobs").DeleteMany(ctx, bson.M{"email": bson.M{"$in": []string{ana, bob}}})
+	})
+
+	// Both users have a pending webhook delivery; neither belongs to a timer
+	for _, email := range []string{ana, bob} {
+		job := Job{ID: "webhook-" + email + "-1", Email: email, TaskType: "WEBHOOK", ExecuteAt: time.Now(), Status: "PENDING"}
+		if err := ScheduleJob(&job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RemoveUserJobs(ana, []string{"webhook-" + ana + "-1", "webhook-" + bob + "-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for email, want := range map[string]int{ana: 0, bob: 1} {
+		jobs, _, err := FindJobs(JobFilter{Email: email, Status: "PENDING"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != want {
+			t.Errorf("%s has %d pending jobs, want %d", email, len(jobs), want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// CalendarFeed is an iCalendar feed attached to a user. Events matching one of
+// its categories or keywords become mute windows for its channels. The feed is
+// either fetched from URL or uploaded, in which case Content holds it.
+type CalendarFeed struct {
+	ID            string     `json:"id"                        bson:"_id"`
+	Email         string     `json:"email"                     bson:"email"`
+	URL           string     `json:"url,omitempty"             bson:"url,omitempty"`
+	Content       string     `json:"-"                         bson:"content,omitempty"`
+	Categories    []string   `json:"categories"                bson:"categories"`
+	Keywords      []string   `json:"keywords"                  bson:"keywords"`
+	Channels      []string   `json:"channels"                  bson:"channels"`
+	Timezone      string     `json:"timezone"                  bson:"timezone"`
+	ContentHash   string     `json:"content_hash,omitempty"    bson:"content_hash,omitempty"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty" bson:"last_fetched_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"      bson:"last_error,omitempty"`
+	HorizonAt     *time.Time `json:"horizon_at,omitempty"      bson:"horizon_at,omitempty"` // end of the generated jobs
+}
+
+// ------------------- FEED FUNCTIONS -------------------
+
+func CreateFeed(feed *CalendarFeed) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("calendar_feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, feed)
+	return err
+}
+
+// GetFeeds returns the feeds of a user, or of all users if email is empty.
+func GetFeeds(email string) ([]CalendarFeed, error) {
+	var feeds []CalendarFeed
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("calendar_feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if email != "" {
+		filter["email"] = email
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &feeds); err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// GetFeed retrieves a feed of a user by ID.
+func GetFeed(email string, feedID string) (CalendarFeed, error) {
+	var feed CalendarFeed
+	if client == nil {
+		return feed, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("calendar_feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": feedID, "email": email}).Decode(&feed)
+	return feed, err
+}
+
+// UpdateFeed replaces a stored feed, returning mongo.ErrNoDocuments if it
+// doesn't exist.
+func UpdateFeed(feed CalendarFeed) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("calendar_feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.ReplaceOne(ctx, bson.M{"_id": feed.ID, "email": feed.Email}, feed)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func RemoveFeed(email string, feedID string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("calendar_feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"_id": feedID, "email": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
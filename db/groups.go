@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// ChannelGroup is a named set of channels of a user. Timers reference it as
+// "group:<name>" in their channels and get the current members whenever
+// their jobs are generated.
+type ChannelGroup struct {
+	Email     string    `json:"-"          bson:"email"`
+	Name      string    `json:"name"       bson:"name"`
+	Channels  []string  `json:"channels"   bson:"channels"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// ------------------- CHANNEL GROUP FUNCTIONS -------------------
+
+// SaveChannelGroup creates or replaces the user's group with the same name.
+func SaveChannelGroup(group ChannelGroup) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("channel_groups")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"email": group.Email, "name": group.Name}
+	_, err := collection.ReplaceOne(ctx, filter, group, options.Replace().SetUpsert(true))
+	return err
+}
+
+// GetChannelGroups returns the groups of a user sorted by name.
+func GetChannelGroups(email string) ([]ChannelGroup, error) {
+	var groups []ChannelGroup
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("channel_groups")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"email": email}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetChannelGroup retrieves a group of a user by name.
+func GetChannelGroup(email string, name string) (ChannelGroup, error) {
+	var group ChannelGroup
+	if client == nil {
+		return group, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("channel_groups")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"email": email, "name": name}).Decode(&group)
+	return group, err
+}
+
+// RemoveChannelGroup deletes a group, returning mongo.ErrNoDocuments if the
+// user has no such group.
+func RemoveChannelGroup(email string, name string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("channel_groups")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"email": email, "name": name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// HolidayCalendar is a named list of holiday dates, imported from an
+// iCalendar file.
+type HolidayCalendar struct {
+	ID       string    `json:"id"       bson:"_id"`
+	Name     string    `json:"name"     bson:"name"`
+	Holidays []Holiday `json:"holidays" bson:"holidays"`
+}
+
+type Holiday struct {
+	Date string `json:"date" bson:"date"` // "2006-01-02"
+	Name string `json:"name" bson:"name"`
+}
+
+// HolidaySettings associates a holiday calendar with a user. CalendarID is
+// either the ID of an imported calendar or "builtin:<country code>".
+type HolidaySettings struct {
+	CalendarID     string   `json:"calendar_id"     bson:"calendar_id"`
+	Channels       []string `json:"channels"        bson:"channels"`
+	Timezone       string   `json:"timezone"        bson:"timezone"`
+	SuppressTimers bool     `json:"suppress_timers" bson:"suppress_timers"`
+}
+
+// ------------------- HOLIDAY FUNCTIONS -------------------
+
+// CreateHolidayCalendar stores an imported holiday calendar.
+func CreateHolidayCalendar(calendar *HolidayCalendar) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("holiday_calendars")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, calendar)
+	return err
+}
+
+// GetHolidayCalendar retrieves an imported holiday calendar by ID.
+func GetHolidayCalendar(calendarID string) (HolidayCalendar, error) {
+	var calendar HolidayCalendar
+	if client == nil {
+		return calendar, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("holiday_calendars")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": calendarID}).Decode(&calendar)
+	return calendar, err
+}
+
+// SetHolidaySettings stores the holiday settings of a user; nil removes them.
+func SetHolidaySettings(email string, settings *HolidaySettings) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"holidays": settings}}
+	if settings == nil {
+		update = bson.M{"$unset": bson.M{"holidays": ""}}
+	}
+	_, err := collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	return err
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// Team groups users under shared quiet-hour policies. Managers edit the team
+// and its policies; every member who accepted their invitation gets a timer
+// for each policy.
+type Team struct {
+	ID        string       `json:"id"         bson:"_id"`
+	Name      string       `json:"name"       bson:"name"`
+	Members   []TeamMember `json:"members"    bson:"members"`
+	Policies  []TeamPolicy `json:"policies"   bson:"policies"`
+	CreatedAt time.Time    `json:"created_at" bson:"created_at"`
+}
+
+type TeamMember struct {
+	Email string `json:"email" bson:"email"`
+	Role  string `json:"role"  bson:"role"` // "manager" or "member"
+	// Pending is set until the member accepts the invitation; policies
+	// don't apply to them and a pending manager can't manage the team yet
+	Pending bool `json:"pending,omitempty" bson:"pending,omitempty"`
+	// OptedOut lists the IDs of the policies the member opted out of; they
+	// only apply while the policy allows opting out
+	OptedOut []string `json:"opted_out,omitempty" bson:"opted_out,omitempty"`
+}
+
+// TeamPolicy is a timer generated for every member. Timer is the template:
+// its ID is unused and its channel references are resolved per member.
+type TeamPolicy struct {
+	ID          string    `json:"id"            bson:"id"`
+	Name        string    `json:"name"          bson:"name"`
+	AllowOptOut bool      `json:"allow_opt_out" bson:"allow_opt_out"`
+	Timer       Timing    `json:"timer"         bson:"timer"`
+	UpdatedAt   time.Time `json:"updated_at"    bson:"updated_at"`
+}
+
+// TimerPolicy marks a timer generated from a team policy.
+type TimerPolicy struct {
+	TeamID      string `json:"team_id"       bson:"team_id"`
+	PolicyID    string `json:"policy_id"     bson:"policy_id"`
+	AllowOptOut bool   `json:"allow_opt_out" bson:"allow_opt_out"`
+}
+
+// ------------------- TEAM FUNCTIONS -------------------
+
+func CreateTeam(team *Team) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("teams")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, team)
+	return err
+}
+
+// GetTeam retrieves a team by ID.
+func GetTeam(teamID string) (Team, error) {
+	var team Team
+	if client == nil {
+		return team, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("teams")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": teamID}).Decode(&team)
+	return team, err
+}
+
+// memberCollation compares strings case-insensitively, so members are
+// found by email regardless of its case.
+var memberCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// GetTeamsForMember returns the teams a user belongs to or is invited to,
+// sorted by name.
+func GetTeamsForMember(email string) ([]Team, error) {
+	var teams []Team
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("teams")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetCollation(memberCollation)
+	cursor, err := collection.Find(ctx, bson.M{"members.email": email}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// updateTeam applies an update to the team matching filter and returns the
+// updated team, or mongo.ErrNoDocuments if none matches. Only the changed
+// fields are written, so concurrent changes to other members and policies
+// are kept.
+func updateTeam(filter bson.M, update bson.M) (Team, error) {
+	var team Team
+	if client == nil {
+		return team, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("teams")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetCollation(memberCollation)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&team)
+	return team, err
+}
+
+// AddTeamMember adds a member to a team, returning mongo.ErrNoDocuments if
+// the team doesn't exist or already has a member with the same email.
+func AddTeamMember(teamID string, member TeamMember) (Team, error) {
+	return updateTeam(
+		bson.M{"_id": teamID, "members.email": bson.M{"$ne": member.Email}},
+		bson.M{"$push": bson.M{"members": member}},
+	)
+}
+
+// SetTeamMemberRole changes the role of a member.
+func SetTeamMemberRole(teamID string, email string, role string) (Team, error) {
+	return updateTeam(
+		bson.M{"_id": teamID, "members.email": email},
+		bson.M{"$set": bson.M{"members.$.role": role}},
+	)
+}
+
+// AcceptTeamInvite clears the pending flag of an invited member.
+func AcceptTeamInvite(teamID string, email string) (Team, error) {
+	return updateTeam(
+		bson.M{"_id": teamID, "members": bson.M{"$elemMatch": bson.M{"email": email, "pending": true}}},
+		bson.M{"$unset": bson.M{"members.$.pending": ""}},
+	)
+}
+
+// RemoveTeamMember removes a member from a team.
+func RemoveTeamMember(teamID string, email string) (Team, error) {
+	return updateTeam(
+		bson.M{"_id": teamID, "members.email": email},
+		bson.M{"$pull": bson.M{"members": bson.M{"email": email}}},
+	)
+}
+
+// SetTeamPolicyOptOut adds or removes a policy from the opt-outs of a member.
+func SetTeamPolicyOptOut(teamID string, email string, policyID string, optOut bool) (Team, error) {
+	op := "$pull"
+	if optOut {
+		op = "$addToSet"
+	}
+	return updateTeam(
+		bson.M{"_id": teamID, "members.email": email},
+		bson.M{op: bson.M{"members.$.opted_out": policyID}},
+	)
+}
+
+// SaveTeamPolicy replaces the policy with the same ID or adds it.
+func SaveTeamPolicy(teamID string, policy TeamPolicy) (Team, error) {
+	team, err := updateTeam(
+		bson.M{"_id": teamID, "policies.id": policy.ID},
+		bson.M{"$set": bson.M{"policies.$": policy}},
+	)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return team, err
+	}
+	return updateTeam(
+		bson.M{"_id": teamID, "policies.id": bson.M{"$ne": policy.ID}},
+		bson.M{"$push": bson.M{"policies": policy}},
+	)
+}
+
+// RemoveTeamPolicy removes a policy from a team.
+func RemoveTeamPolicy(teamID string, policyID string) (Team, error) {
+	return updateTeam(
+		bson.M{"_id": teamID, "policies.id": policyID},
+		bson.M{"$pull": bson.M{"policies": bson.M{"id": policyID}}},
+	)
+}
+
+func RemoveTeam(teamID string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("teams")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"_id": teamID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestTeamUpdates(t *testing.T) {
+	connectTestDB(t)
+	team := Team{
+		ID:        "team-test-" + time.Now().Format("150405.000000"),
+		Name:      "Platform",
+		Members:   []TeamMember{{Email: "ana@example.com", Role: "manager"}},
+		Policies:  []TeamPolicy{},
+		CreatedAt: time.Now(),
+	}
+	if err := CreateTeam(&team); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RemoveTeam(team.ID) })
+
+	if _, err := AddTeamMember(team.ID, TeamMember{Email: "Bob@example.com", Role: "member", Pending: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddTeamMember(team.ID, TeamMember{Email: "bob@example.com", Role: "member", Pending: true}); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("adding a member twice = %v, want mongo.ErrNoDocuments", err)
+	}
+
+	// Members are found regardless of the case of their email
+	teams, err := GetTeamsForMember("bob@EXAMPLE.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(teams, func(found Team) bool { return found.ID == team.ID }) {
+		t.Errorf("GetTeamsForMember didn't find the team: %v", teams)
+	}
+
+	// Saving a policy and accepting an invitation only write their own
+	// fields, so neither undoes the other
+	if _, err := SaveTeamPolicy(team.ID, TeamPolicy{ID: "p1", Name: "Evenings"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcceptTeamInvite(team.ID, "bob@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcceptTeamInvite(team.ID, "bob@example.com"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("accepting twice = %v, want mongo.ErrNoDocuments", err)
+	}
+	updated, err := SaveTeamPolicy(team.ID, TeamPolicy{ID: "p1", Name: "Late evenings"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Policies) != 1 || updated.Policies[0].Name != "Late evenings" {
+		t.Errorf("policies = %+v, want the renamed policy only", updated.Policies)
+	}
+	if len(updated.Members) != 2 || updated.Members[1].Pending || updated.Members[1].Email != "Bob@example.com" {
+		t.Errorf("members = %+v, want Bob to have accepted", updated.Members)
+	}
+
+	if updated, err = SetTeamPolicyOptOut(team.ID, "bob@example.com", "p1", true); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(updated.Members[1].OptedOut, []string{"p1"}) {
+		t.Errorf("opted out = %v", updated.Members[1].OptedOut)
+	}
+	if updated, err = RemoveTeamMember(team.ID, "Bob@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err = RemoveTeamPolicy(team.ID, "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Members) != 1 || len(updated.Policies) != 0 {
+		t.Errorf("team = %+v, want only Ana left", updated)
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// UrgentRules let messages through a timer's window: a message in one of its
+// muted channels that contains one of Keywords (case-insensitively) or comes
+// from one of Senders (email or Cliq user ID) is forwarded to the user.
+type UrgentRules struct {
+	Keywords []string `json:"keywords,omitempty" bson:"keywords,omitempty"`
+	Senders  []string `json:"senders,omitempty"  bson:"senders,omitempty"`
+}
+
+// UrgentAlert records a message that matched urgent rules and whether the
+// user was notified of it.
+type UrgentAlert struct {
+	ID         string    `json:"id"                bson:"_id"`
+	Email      string    `json:"-"                 bson:"email"`
+	TimerID    string    `json:"timer_id"          bson:"timer_id"`
+	ChatID     string    `json:"chat_id"           bson:"chat_id"`
+	MessageID  string    `json:"message_id"        bson:"message_id"`
+	SenderID   string    `json:"sender_id"         bson:"sender_id"`
+	SenderName string    `json:"sender_name"       bson:"sender_name"`
+	Rule       string    `json:"rule"              bson:"rule"` // "keyword:<keyword>" or "sender:<sender>"
+	Excerpt    string    `json:"excerpt"           bson:"excerpt"`
+	Notified   bool      `json:"notified"          bson:"notified"`
+	Reason     string    `json:"reason,omitempty"  bson:"reason,omitempty"` // why the user wasn't notified
+	At         time.Time `json:"at"                bson:"at"`
+}
+
+// ------------------- URGENT ALERT FUNCTIONS -------------------
+
+func AddUrgentAlert(alert UrgentAlert) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("urgent_alerts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, alert)
+	return err
+}
+
+// CountUrgentNotifications counts the alerts the user was notified of since
+// the given time.
+func CountUrgentNotifications(email string, since time.Time) (int64, error) {
+	if client == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("urgent_alerts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return collection.CountDocuments(ctx, bson.M{"email": email, "notified": true, "at": bson.M{"$gte": since}})
+}
+
+// GetUrgentAlerts returns the latest urgent alerts of a user, newest first.
+func GetUrgentAlerts(email string, limit int64) ([]UrgentAlert, error) {
+	var alerts []UrgentAlert
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("urgent_alerts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{"email": email}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ------------------- DATA MODELS -------------------
+
+// Webhook is a user's subscription to events, delivered as signed JSON POSTs
+// to URL. An empty Events list subscribes to every event.
+type Webhook struct {
+	ID        string    `json:"id"         bson:"_id"`
+	Email     string    `json:"-"          bson:"email"`
+	URL       string    `json:"url"        bson:"url"`
+	Secret    string    `json:"-"          bson:"secret"`
+	Events    []string  `json:"events"     bson:"events"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// WebhookDelivery logs one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         string    `json:"id"                    bson:"_id"`
+	WebhookID  string    `json:"webhook_id"            bson:"webhook_id"`
+	Email      string    `json:"-"                     bson:"email"`
+	EventID    string    `json:"event_id"              bson:"event_id"`
+	Event      string    `json:"event"                 bson:"event"`
+	Attempt    int       `json:"attempt"               bson:"attempt"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"       bson:"error,omitempty"`
+	Success    bool      `json:"success"               bson:"success"`
+	At         time.Time `json:"at"                    bson:"at"`
+}
+
+// ------------------- WEBHOOK FUNCTIONS -------------------
+
+func CreateWebhook(webhook *Webhook) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, webhook)
+	return err
+}
+
+// GetWebhooks returns the webhooks of a user.
+func GetWebhooks(email string) ([]Webhook, error) {
+	var webhooks []Webhook
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"email": email})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook retrieves a webhook of a user by ID.
+func GetWebhook(email string, webhookID string) (Webhook, error) {
+	var webhook Webhook
+	if client == nil {
+		return webhook, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOne(ctx, bson.M{"_id": webhookID, "email": email}).Decode(&webhook)
+	return webhook, err
+}
+
+func RemoveWebhook(email string, webhookID string) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := collection.DeleteOne(ctx, bson.M{"_id": webhookID, "email": email})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RecordEvent stores the ID of an emitted event. It reports false if the
+// event was already recorded, so each event is only delivered once.
+func RecordEvent(eventID string, event string) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhook_events")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, bson.M{"_id": eventID, "event": event, "at": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func AddWebhookDelivery(delivery WebhookDelivery) error {
+	if client == nil {
+		return fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, delivery)
+	return err
+}
+
+// GetWebhookDeliveries returns the latest delivery attempts of a webhook,
+// newest first.
+func GetWebhookDeliveries(email string, webhookID string, limit int64) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if client == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	collection := client.Database("afterwork").Collection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{"email": email, "webhook_id": webhookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
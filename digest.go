@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+const (
+	// digestChannel stands in for the channel in the IDs of digest jobs.
+	digestChannel = "digest"
+	// digestDelay is how long after a window ends its digest is sent, so the
+	// UNMUTE jobs have run.
+	digestDelay = time.Minute
+	// maxDigestChannels and maxMessagePages bound the Cliq requests of one
+	// digest.
+	maxDigestChannels = 50
+	maxMessagePages   = 10
+	// digestTimeout bounds a DIGEST job, which reads up to maxDigestChannels
+	// channels one after the other. Channels not read after digestFetchTime
+	// are left out so there's time left to send the digest.
+	digestTimeout   = 5 * time.Minute
+	digestFetchTime = 4 * time.Minute
+	// defaultCliqBot is the unique name of the extension's bot, which sends
+	// the digest; CLIQ_BOT_NAME overrides it.
+	defaultCliqBot = "afterworkbuddy"
+)
+
+func init() {
+	registerJobAction("DIGEST", digestAction{})
+}
+
+// channelActivity is what happened in one channel during a window.
+type channelActivity struct {
+	ChannelID string
+	Messages  int
+	Mentions  int
+}
+
+// cliqChatMessage is a message as returned by the chat messages API.
+type cliqChatMessage struct {
+	ID     string `json:"id"`
+	Time   int64  `json:"time"` // Unix milliseconds
+	Sender struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"sender"`
+	Mentions []struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+	} `json:"mentions"`
+}
+
+// fetchChannelActivity counts the messages others sent to a chat between
+// from and to, and those mentioning the user. It pages backwards through
+// GET /chats/{id}/messages, newest first.
+func fetchChannelActivity(ctx context.Context, accessToken string, email string, chatID string, from, to time.Time) (channelActivity, error) {
+	activity := channelActivity{ChannelID: chatID}
+	until := to.UnixMilli()
+	for page := 0; page < maxMessagePages; page++ {
+		query := url.Values{
+			"fromtime": {strconv.FormatInt(from.UnixMilli(), 10)},
+			"totime":   {strconv.FormatInt(until, 10)},
+			"limit":    {"100"},
+		}
+		var resp struct {
+			Data []cliqChatMessage `json:"data"`
+		}
+		if err := cliqGet(ctx, accessToken, "/chats/"+url.PathEscape(chatID)+"/messages?"+query.Encode(), &resp); err != nil {
+			return activity, err
+		}
+		for _, msg := range resp.Data {
+			if msg.Time < until {
+				until = msg.Time
+			}
+			if strings.EqualFold(msg.Sender.Email, email) {
+				continue
+			}
+			activity.Messages++
+			for _, mention := range msg.Mentions {
+				if strings.EqualFold(mention.Email, email) {
+					activity.Mentions++
+					break
+				}
+			}
+		}
+		if len(resp.Data) < 100 {
+			break
+		}
+		until-- // The oldest message was counted
+	}
+	return activity, nil
+}
+
+// fetchDigest collects the activity of each channel during a window.
+// Channels that can't be read, or aren't reached before ctx is done, are
+// left out; an error is only returned if none could be read.
+func fetchDigest(ctx context.Context, accessToken string, email string, channels []string, from, to time.Time) ([]channelActivity, error) {
+	if len(channels) > maxDigestChannels {
+		log.Printf("Digest for user %s only covers %d of %d channels", email, maxDigestChannels, len(channels))
+		channels = channels[:maxDigestChannels]
+	}
+	var activities []channelActivity
+	var lastErr error
+	for i, channel := range channels {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Digest for user %s only covers %d of %d channels: %v", email, i, len(channels), err)
+			if len(activities) == 0 {
+				return nil, err
+			}
+			break
+		}
+		activity, err := fetchChannelActivity(ctx, accessToken, email, channel, from, to)
+		if err != nil {
+			log.Printf("Error reading messages of channel %s for user %s: %v", channel, email, err)
+			lastErr = err
+			continue
+		}
+		activities = append(activities, activity)
+	}
+	if len(activities) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return activities, nil
+}
+
+// formatDigest renders the digest message, busiest channels first. names
+// maps channel IDs to display names.
+func formatDigest(activities []channelActivity, names map[string]string, from, to time.Time) string {
+	header := fmt.Sprintf("While you were away (%s–%s):", from.Format("15:04"), to.Format("15:04 MST"))
+	sort.SliceStable(activities, func(i, j int) bool {
+		if activities[i].Mentions != activities[j].Mentions {
+			return activities[i].Mentions > activities[j].Mentions
+		}
+		return activities[i].Messages > activities[j].Messages
+	})
+
+	var lines []string
+	for _, activity := range activities {
+		if activity.Messages == 0 {
+			continue
+		}
+		name := names[activity.ChannelID]
+		if name == "" {
+			name = activity.ChannelID
+		}
+		line := fmt.Sprintf("- %s: %d message(s)", name, activity.Messages)
+		if activity.Mentions > 0 {
+			line += fmt.Sprintf(", %d mention(s) of you", activity.Mentions)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return header + "\nNothing new in your muted channels."
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+// sendBotMessage posts a message from the extension's bot to the user.
+func sendBotMessage(ctx context.Context, accessToken string, text string) error {
+	bot := os.Getenv("CLIQ_BOT_NAME")
+	if bot == "" {
+		bot = defaultCliqBot
+	}
+	return cliqPost(ctx, accessToken, "/bots/"+url.PathEscape(bot)+"/message", map[string]string{"text": text})
+}
+
+// scheduleDigestJob stores and schedules the DIGEST job of one window. Its
+// payload carries the window and the channels it mutes.
+func scheduleDigestJob(email string, timer db.Timing, channels []string, muteAt, unmuteAt time.Time) {
+	if len(channels) == 0 {
+		return
+	}
+	loc, err := timerLocation(timer)
+	if err != nil {
+		loc = time.UTC
+	}
+	job := db.Job{
+		Email:     email,
+		TaskType:  "DIGEST",
+		ExecuteAt: unmuteAt.Add(digestDelay),
+		Status:    "PENDING",
+		TimerID:   timer.ID,
+		Payload: map[string]string{
+			"from":     muteAt.Format(time.RFC3339),
+			"to":       unmuteAt.Format(time.RFC3339),
+			"timezone": loc.String(),
+			"channels": strings.Join(channels, ","),
+		},
+	}
+	job.ID = jobID(timer.ID, digestChannel, job.TaskType, job.ExecuteAt)
+	if err := db.ScheduleJob(&job); err != nil {
+		log.Printf("Could not schedule %s job %s (might already exist or DB error): %v", job.TaskType, job.ID, err)
+		return
+	}
+	log.Printf("Scheduled %s job %s for %s", job.TaskType, job.ID, job.ExecuteAt.Format(time.RFC3339))
+	scheduleJob(job)
+}
+
+// digestAction sends the user a summary of their muted channels' activity
+// during the window.
+type digestAction struct{}
+
+func (digestAction) Execute(ctx context.Context, job db.Job) error {
+	from, err := time.Parse(time.RFC3339, job.Payload["from"])
+	if err != nil {
+		return fmt.Errorf("invalid digest window start: %w", err)
+	}
+	to, err := time.Parse(time.RFC3339, job.Payload["to"])
+	if err != nil {
+		return fmt.Errorf("invalid digest window end: %w", err)
+	}
+	if loc, err := time.LoadLocation(job.Payload["timezone"]); err == nil {
+		from, to = from.In(loc), to.In(loc)
+	}
+	var channels []string
+	if job.Payload["channels"] != "" {
+		channels = strings.Split(job.Payload["channels"], ",")
+	}
+
+	accessToken, err := refreshAccessToken(job.Email)
+	if err != nil {
+		return err
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, digestFetchTime)
+	defer cancel()
+	activities, err := fetchDigest(fetchCtx, accessToken, job.Email, channels, from, to)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]string)
+	if available, err := userChannels(job.Email, false); err == nil {
+		for _, channel := range available {
+			names[channel.ID] = channel.Name
+		}
+	}
+	return sendBotMessage(ctx, accessToken, formatDigest(activities, names, from, to))
+}
+
+func (digestAction) Timeout() time.Duration {
+	return digestTimeout
+}
+
+// Compensate does nothing: a sent message can't be taken back.
+func (digestAction) Compensate(ctx context.Context, job db.Job) error {
+	return nil
+}
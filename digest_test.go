@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chatMessage returns a message sent at t by sender, mentioning the given
+// users.
+func chatMessage(t time.Time, sender string, mentions ...string) cliqChatMessage {
+	var msg cliqChatMessage
+	msg.ID = sender + t.Format("150405.000")
+	msg.Time = t.UnixMilli()
+	msg.Sender.Email = sender
+	for _, email := range mentions {
+		msg.Mentions = append(msg.Mentions, struct {
+			ID    string `json:"id"`
+			Email string `json:"email"`
+		}{Email: email})
+	}
+	return msg
+}
+
+func TestFetchChannelActivity(t *testing.T) {
+	from := time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Hour)
+
+	// 250 messages from others spread over the window, newest first, so
+	// the window takes three pages; one in ten mentions the user
+	var messages []cliqChatMessage
+	messages = append(messages, chatMessage(to.Add(time.Second), "bob@example.com", "ana@example.com"))
+	messages = append(messages, chatMessage(to, "bob@example.com"))
+	for i := 248; i >= 1; i-- {
+		var mentions []string
+		if i%10 == 0 {
+			mentions = []string{"ANA@example.com"}
+		}
+		messages = append(messages, chatMessage(from.Add(time.Duration(i)*28*time.Second), "bob@example.com", mentions...))
+	}
+	messages = append(messages, chatMessage(from.Add(time.Second), "ana@example.com", "ana@example.com"))
+	messages = append(messages, chatMessage(from, "carol@example.com"))
+	messages = append(messages, chatMessage(from.Add(-time.Second), "carol@example.com", "ana@example.com"))
+
+	fake := &fakeCliq{messages: map[string][]cliqChatMessage{"CT_1": messages}}
+	serveFakeCliq(t, fake)
+
+	activity, err := fetchChannelActivity(t.Context(), fake.token, "ana@example.com", "CT_1", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Messages at both bounds count, the user's own and those outside don't
+	if activity.ChannelID != "CT_1" || activity.Messages != 250 || activity.Mentions != 24 {
+		t.Errorf("activity = %+v, want 250 messages and 24 mentions", activity)
+	}
+	if n := fake.requested("GET /api/v2/chats/CT_1/messages"); n != 3 {
+		t.Errorf("fetched %d pages, want 3", n)
+	}
+
+	if _, err := fetchChannelActivity(t.Context(), "expired", "ana@example.com", "CT_1", from, to); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+}
+
+func TestFetchDigestSkipsUnreadableChannels(t *testing.T) {
+	from := time.Date(2026, time.March, 2, 18, 0, 0, 0, time.UTC)
+	fake := &fakeCliq{messages: map[string][]cliqChatMessage{
+		"CT_1": {chatMessage(from.Add(time.Minute), "bob@example.com")},
+	}}
+	serveFakeCliq(t, fake)
+
+	// The fake answers 404 for CT_2, which is left out of the digest
+	activities, err := fetchDigest(t.Context(), fake.token, "ana@example.com", []string{"CT_1", "CT_2"}, from, from.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].ChannelID != "CT_1" || activities[0].Messages != 1 {
+		t.Errorf("activities = %+v", activities)
+	}
+
+	if _, err := fetchDigest(t.Context(), "expired", "ana@example.com", []string{"CT_1"}, from, from.Add(time.Hour)); err == nil {
+		t.Error("expected an error when no channel can be read")
+	}
+
+	// Channels aren't read any more once the deadline has passed
+	requested := fake.requested("GET /api/v2/chats/")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := fetchDigest(ctx, fake.token, "ana@example.com", []string{"CT_1"}, from, from.Add(time.Hour)); !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchDigest after the deadline = %v, want context.Canceled", err)
+	}
+	if n := fake.requested("GET /api/v2/chats/"); n != requested {
+		t.Errorf("fetched %d pages after the deadline", n-requested)
+	}
+}
+
+func TestFormatDigest(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	from := time.Date(2026, time.March, 2, 18, 0, 0, 0, berlin)
+	to := from.Add(90 * time.Minute)
+
+	got := formatDigest([]channelActivity{
+		{ChannelID: "CT_quiet"},
+		{ChannelID: "CT_busy", Messages: 40},
+		{ChannelID: "CT_1", Messages: 3, Mentions: 1},
+		{ChannelID: "CT_2", Messages: 12},
+	}, map[string]string{"CT_busy": "#random", "CT_1": "#incidents"}, from, to)
+	want := strings.Join([]string{
+		"While you were away (18:00–19:30 CET):",
+		"- #incidents: 3 message(s), 1 mention(s) of you",
+		"- #random: 40 message(s)",
+		"- CT_2: 12 message(s)",
+	}, "\n")
+	if got != want {
+		t.Errorf("formatDigest =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := formatDigest(nil, nil, from, to); !strings.HasSuffix(got, "\nNothing new in your muted channels.") {
+		t.Errorf("empty digest = %q", got)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// feedRequest is the JSON body of POST /feeds for a feed fetched from a URL:
+//
+//	{
+//	  "url": "https://calendar.example.com/me.ics",
+//	  "categories": ["Focus"],       // events with one of these categories
+//	  "keywords": ["OOO"],           // or one of these words in the summary
+//	  "channels": ["CT_1234"],       // chat IDs muted during the events
+//	  "timezone": "Europe/Berlin"    // for floating times, defaults to UTC
+//	}
+//
+// Uploaded feeds send the same fields as query parameters with the .ics file
+// as multipart "file" or raw body.
+type feedRequest struct {
+	URL        string   `json:"url"`
+	Categories []string `json:"categories"`
+	Keywords   []string `json:"keywords"`
+	Channels   []string `json:"channels"`
+	Timezone   string   `json:"timezone"`
+}
+
+// parseFeedRequest reads a feedRequest from a JSON body or the query
+// parameters (url, repeated categories, keywords and channels, timezone).
+func parseFeedRequest(c *fiber.Ctx) (feedRequest, []fieldError) {
+	var req feedRequest
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := c.BodyParser(&req); err != nil {
+			return req, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}}
+		}
+		if req.URL == "" {
+			return req, []fieldError{{Field: "url", Message: "is required in JSON requests; upload calendar files as the body"}}
+		}
+		return req, nil
+	}
+
+	req.URL = c.Query("url")
+	req.Timezone = c.Query("timezone")
+	args := c.Context().QueryArgs()
+	for _, v := range args.PeekMulti("categories") {
+		req.Categories = append(req.Categories, string(v))
+	}
+	for _, v := range args.PeekMulti("keywords") {
+		req.Keywords = append(req.Keywords, string(v))
+	}
+	for _, v := range args.PeekMulti("channels") {
+		req.Channels = append(req.Channels, string(v))
+	}
+	return req, nil
+}
+
+func (r feedRequest) validate() []fieldError {
+	var fields []fieldError
+	if len(r.Channels) == 0 {
+		fields = append(fields, fieldError{Field: "channels", Message: "must contain at least one channel"})
+	}
+	for i, channel := range r.Channels {
+		if strings.TrimSpace(channel) == "" {
+			fields = append(fields, fieldError{Field: "channels[" + strconv.Itoa(i) + "]", Message: "must not be empty"})
+		}
+	}
+	if len(r.Categories) == 0 && len(r.Keywords) == 0 {
+		fields = append(fields, fieldError{Field: "categories", Message: "at least one category or keyword is required"})
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		fields = append(fields, fieldError{Field: "timezone", Message: "must be an IANA timezone name"})
+	}
+	if r.URL != "" {
+		if err := validateOutboundURL(r.URL); err != nil {
+			fields = append(fields, fieldError{Field: "url", Message: "must be a public http or https URL"})
+		}
+	}
+	return fields
+}
+
+// createFeedHandler attaches a calendar feed to the user and generates the
+// jobs of its upcoming windows.
+func createFeedHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	req, fields := parseFeedRequest(c)
+	if len(fields) == 0 {
+		fields = req.validate()
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	feed := db.CalendarFeed{
+		ID:         uuid.New().String(),
+		Email:      email,
+		URL:        req.URL,
+		Categories: req.Categories,
+		Keywords:   req.Keywords,
+		Channels:   req.Channels,
+		Timezone:   req.Timezone,
+	}
+	if feed.URL == "" {
+		content, err := uploadedFeed(c)
+		if err != nil {
+			return sendValidationError(c, []fieldError{{Field: "file", Message: err.Error()}})
+		}
+		feed.Content = content
+	}
+
+	if err := db.CreateFeed(&feed); err != nil {
+		log.Printf("Error saving feed for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save feed")
+	}
+	if err := syncFeed(feed, true); err != nil {
+		log.Printf("Error syncing new feed %s: %v", feed.ID, err)
+	}
+	if stored, err := db.GetFeed(email, feed.ID); err == nil {
+		feed = stored
+	}
+	return c.Status(fiber.StatusCreated).JSON(feed)
+}
+
+// listFeedsHandler lists the user's feeds with their sync state.
+func listFeedsHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	feeds, err := db.GetFeeds(email)
+	if err != nil {
+		log.Printf("Error listing feeds for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list feeds")
+	}
+	if feeds == nil {
+		feeds = []db.CalendarFeed{}
+	}
+	return c.Status(fiber.StatusOK).JSON(feeds)
+}
+
+// loadFeed returns the :id feed of the user, answering the request itself
+// if it can't be loaded.
+func loadFeed(c *fiber.Ctx) (db.CalendarFeed, bool, error) {
+	feed, err := db.GetFeed(userEmail(c), c.Params("id"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return feed, false, sendError(c, fiber.StatusNotFound, "not_found", "Feed not found")
+		}
+		log.Printf("Error loading feed %s: %v", c.Params("id"), err)
+		return feed, false, sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load feed")
+	}
+	return feed, true, nil
+}
+
+// putFeedContentHandler replaces the calendar of an uploaded feed.
+func putFeedContentHandler(c *fiber.Ctx) error {
+	feed, ok, err := loadFeed(c)
+	if !ok {
+		return err
+	}
+	if feed.URL != "" {
+		return sendError(c, fiber.StatusConflict, "url_feed", "Feed is fetched from its url")
+	}
+	if feed.Content, err = uploadedFeed(c); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "file", Message: err.Error()}})
+	}
+	if err := syncFeed(feed, false); err != nil {
+		log.Printf("Error syncing feed %s: %v", feed.ID, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", feedGenerateError)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// syncFeedHandler fetches a feed now and regenerates its windows.
+func syncFeedHandler(c *fiber.Ctx) error {
+	feed, ok, err := loadFeed(c)
+	if !ok {
+		return err
+	}
+	if err := syncFeed(feed, true); err != nil {
+		log.Printf("Error syncing feed %s: %v", feed.ID, err)
+		return sendError(c, fiber.StatusBadGateway, "feed_unavailable", "Failed to sync feed")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// deleteFeedHandler removes a feed and its pending jobs.
+func deleteFeedHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+	if err := db.RemoveFeed(email, id); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Feed not found")
+		}
+		log.Printf("Error removing feed %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete feed")
+	}
+	if _, err := cancelFutureJobs(feedTimerID(id)); err != nil {
+		log.Printf("Warning: failed to remove pending jobs for feed %s: %v", id, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
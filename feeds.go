@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/EthicalGopher/AfterWork_Buddy/ical"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// feedHorizon is how far ahead feed events are turned into jobs
+	feedHorizon = 7 * 24 * time.Hour
+	// feedExtendAfter is how long after generating a feed's jobs they are
+	// generated again to reach feedHorizon ahead, even if it didn't change
+	feedExtendAfter = 24 * time.Hour
+	// feedRefreshInterval is how often URL feeds are fetched for changes
+	feedRefreshInterval = 15 * time.Minute
+	// maxFeedSize limits the size of a fetched or uploaded feed
+	maxFeedSize = 5 << 20
+)
+
+// feedClient fetches URL feeds; it only connects to public addresses.
+var feedClient = newOutboundClient(30 * time.Second)
+
+// feedTimerID is the TimerID of the jobs generated from a calendar feed.
+func feedTimerID(feedID string) string {
+	return "feed-" + feedID
+}
+
+// fetchFeed returns the iCalendar content of a feed.
+func fetchFeed(feed db.CalendarFeed) ([]byte, error) {
+	if feed.URL == "" {
+		return []byte(feed.Content), nil
+	}
+	u, err := url.Parse(feed.URL)
+	if err == nil {
+		err = checkOutboundURL(u)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed url: %w", err)
+	}
+	resp, err := feedClient.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("error fetching feed: status %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed: %w", err)
+	}
+	if len(content) > maxFeedSize {
+		return nil, fmt.Errorf("feed is larger than %d bytes", maxFeedSize)
+	}
+	return content, nil
+}
+
+// uploadedFeed reads a feed uploaded as multipart "file" or as the raw body.
+func uploadedFeed(c *fiber.Ctx) (string, error) {
+	content := c.Body()
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("could not read uploaded file")
+		}
+		defer f.Close()
+		if content, err = io.ReadAll(io.LimitReader(f, maxFeedSize+1)); err != nil {
+			return "", fmt.Errorf("could not read uploaded file")
+		}
+	}
+	if len(content) == 0 {
+		return "", fmt.Errorf("either url or a calendar file is required")
+	}
+	if len(content) > maxFeedSize {
+		return "", fmt.Errorf("feed is larger than %d bytes", maxFeedSize)
+	}
+	if _, err := ical.Parse(bytes.NewReader(content), time.UTC); err != nil {
+		return "", fmt.Errorf("invalid calendar: %w", err)
+	}
+	return string(content), nil
+}
+
+// matchesFeed reports whether an event has one of the feed's categories or
+// contains one of its keywords in the summary.
+func matchesFeed(feed db.CalendarFeed, event ical.Event) bool {
+	for _, category := range feed.Categories {
+		for _, eventCategory := range event.Categories {
+			if strings.EqualFold(category, eventCategory) {
+				return true
+			}
+		}
+	}
+	summary := strings.ToLower(event.Summary)
+	for _, keyword := range feed.Keywords {
+		if keyword != "" && strings.Contains(summary, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedWindows returns the mute windows of the matching events overlapping
+// [now, now+feedHorizon), with overlapping windows merged.
+func feedWindows(feed db.CalendarFeed, content []byte, now time.Time) ([]ical.Occurrence, error) {
+	loc := time.UTC
+	if feed.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(feed.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	events, err := ical.Parse(bytes.NewReader(content), loc)
+	if err != nil {
+		return nil, err
+	}
+	events = ical.ApplyOverrides(events)
+
+	var windows []ical.Occurrence
+	for _, event := range events {
+		if !matchesFeed(feed, event) {
+			continue
+		}
+		occurrences, err := event.Occurrences(now, now.Add(feedHorizon))
+		if err != nil {
+			log.Printf("Skipping event %q of feed %s: %v", event.UID, feed.ID, err)
+			continue
+		}
+		windows = append(windows, occurrences...)
+	}
+
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	var merged []ical.Occurrence
+	for _, window := range windows {
+		if !window.End.After(window.Start) {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && !window.Start.After(merged[last].End) {
+			if window.End.After(merged[last].End) {
+				merged[last].End = window.End
+			}
+			continue
+		}
+		merged = append(merged, window)
+	}
+	return merged, nil
+}
+
+// Feed errors shown to users; the details, which may quote the fetched
+// content, are only logged.
+const (
+	feedFetchError    = "Failed to fetch the feed"
+	feedGenerateError = "Failed to generate windows from the feed"
+)
+
+// horizonDue reports whether the jobs of a feed must be regenerated to keep
+// reaching feedHorizon ahead.
+func horizonDue(feed db.CalendarFeed, now time.Time) bool {
+	return feed.HorizonAt == nil || feed.HorizonAt.Before(now.Add(feedHorizon-feedExtendAfter))
+}
+
+// syncFeed fetches a feed and, if its content changed, its horizon is due
+// or force is set, regenerates the jobs of its upcoming windows.
+func syncFeed(feed db.CalendarFeed, force bool) error {
+	now := time.Now().Truncate(time.Millisecond)
+	feed.LastFetchedAt = &now
+	feed.LastError = ""
+
+	content, err := fetchFeed(feed)
+	if err != nil {
+		feed.LastError = feedFetchError
+	} else {
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if hash != feed.ContentHash || horizonDue(feed, now) || force {
+			err = regenerateFeedJobs(feed, content, now)
+			if err == nil {
+				horizon := now.Add(feedHorizon)
+				feed.ContentHash = hash
+				feed.HorizonAt = &horizon
+			} else {
+				feed.LastError = feedGenerateError
+			}
+		}
+	}
+	if updateErr := db.UpdateFeed(feed); updateErr != nil {
+		log.Printf("Error saving state of feed %s: %v", feed.ID, updateErr)
+	}
+	return err
+}
+
+func regenerateFeedJobs(feed db.CalendarFeed, content []byte, now time.Time) error {
+	windows, err := feedWindows(feed, content, now)
+	if err != nil {
+		return err
+	}
+	timerID := feedTimerID(feed.ID)
+	if _, err := cancelFutureJobs(timerID); err != nil {
+		return err
+	}
+	for _, window := range windows {
+		scheduleWindowJobs(feed.Email, timerID, feed.Channels, window.Start, window.End)
+	}
+	log.Printf("Generated %d windows from feed %s of user %s", len(windows), feed.ID, feed.Email)
+	return nil
+}
+
+// syncAllFeeds syncs every feed; feeds only regenerate if they changed or
+// their horizon is due unless force is set. Uploaded feeds can't change, so
+// they are only read when their horizon is due.
+func syncAllFeeds(force bool) {
+	feeds, err := db.GetFeeds("")
+	if err != nil {
+		log.Printf("Error getting calendar feeds: %v", err)
+		return
+	}
+	for _, feed := range feeds {
+		if feed.URL == "" && !force && !horizonDue(feed, time.Now()) {
+			continue
+		}
+		if err := syncFeed(feed, force); err != nil {
+			log.Printf("Error syncing feed %s of user %s: %v", feed.ID, feed.Email, err)
+		}
+	}
+}
+
+// refreshFeeds periodically checks URL feeds for changes and extends the
+// horizon of every feed.
+func refreshFeeds() {
+	ticker := time.NewTicker(feedRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		syncAllFeeds(false)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+const testFeed = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:focus
+SUMMARY:Focus time
+CATEGORIES:Focus
+DTSTART;TZID=Europe/Berlin:20260105T090000
+DTEND;TZID=Europe/Berlin:20260105T110000
+RRULE:FREQ=DAILY;COUNT=5
+END:VEVENT
+BEGIN:VEVENT
+UID:focus
+RECURRENCE-ID;TZID=Europe/Berlin:20260106T090000
+DTSTART;TZID=Europe/Berlin:20260106T140000
+DTEND;TZID=Europe/Berlin:20260106T150000
+END:VEVENT
+BEGIN:VEVENT
+UID:focus
+RECURRENCE-ID;TZID=Europe/Berlin:20260107T090000
+DTSTART;TZID=Europe/Berlin:20260107T090000
+DTEND;TZID=Europe/Berlin:20260107T110000
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:lunch
+SUMMARY:OOO lunch
+DTSTART;TZID=Europe/Berlin:20260105T103000
+DTEND;TZID=Europe/Berlin:20260105T120000
+END:VEVENT
+BEGIN:VEVENT
+UID:standup
+SUMMARY:Standup
+DTSTART;TZID=Europe/Berlin:20260105T083000
+DTEND;TZID=Europe/Berlin:20260105T084500
+END:VEVENT
+END:VCALENDAR
+`
+
+func serveFeed(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.ics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(testFeed))
+	})
+	mux.Handle("/moved.ics", http.RedirectHandler("/feed.ics", http.StatusFound))
+	mux.HandleFunc("/missing.ics", http.NotFound)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// useFeedClient lets the test fetch feeds from the local server, which the
+// outbound client refuses to connect to.
+func useFeedClient(t *testing.T, client *http.Client) {
+	t.Helper()
+	previous := feedClient
+	feedClient = client
+	t.Cleanup(func() { feedClient = previous })
+}
+
+func TestFetchFeedWindows(t *testing.T) {
+	srv := serveFeed(t)
+	useFeedClient(t, srv.Client())
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, berlin)
+	}
+
+	feed := db.CalendarFeed{
+		ID:         "test",
+		URL:        srv.URL + "/moved.ics",
+		Categories: []string{"focus"},
+		Keywords:   []string{"ooo"},
+		Timezone:   "Europe/Berlin",
+	}
+	content, err := fetchFeed(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows, err := feedWindows(feed, content, at(5, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ start, end time.Time }{
+		// The focus block and the overlapping lunch are merged
+		{at(5, 9, 0), at(5, 12, 0)},
+		// The 6th is moved to the afternoon, the 7th is cancelled
+		{at(6, 14, 0), at(6, 15, 0)},
+		{at(8, 9, 0), at(8, 11, 0)},
+		{at(9, 9, 0), at(9, 11, 0)},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("got %d windows %v, want %d", len(windows), windows, len(want))
+	}
+	for i, w := range want {
+		if !windows[i].Start.Equal(w.start) || !windows[i].End.Equal(w.end) {
+			t.Errorf("window %d = %s-%s, want %s-%s", i, windows[i].Start, windows[i].End, w.start, w.end)
+		}
+	}
+}
+
+func TestFetchFeedErrors(t *testing.T) {
+	srv := serveFeed(t)
+	useFeedClient(t, srv.Client())
+
+	for _, url := range []string{srv.URL + "/missing.ics", "file:///etc/passwd", "ftp://example.com/feed.ics"} {
+		if _, err := fetchFeed(db.CalendarFeed{URL: url}); err == nil {
+			t.Errorf("fetching %s: expected an error", url)
+		}
+	}
+}
+
+func TestOutboundClientRefusesLocalAddresses(t *testing.T) {
+	srv := serveFeed(t)
+	client := newOutboundClient(5 * time.Second)
+
+	for _, path := range []string{"/feed.ics", "/moved.ics"} {
+		_, err := client.Get(srv.URL + path)
+		if !errors.Is(err, errForbiddenAddress) {
+			t.Errorf("GET %s: error = %v, want errForbiddenAddress", path, err)
+		}
+	}
+
+	// Redirects from a public server to a private one are checked the same
+	// way, as every connection goes through dialControl
+	if err := dialControl("tcp", "169.254.169.254:80", nil); !errors.Is(err, errForbiddenAddress) {
+		t.Errorf("dialControl(metadata address) = %v", err)
+	}
+	if err := dialControl("tcp", "93.184.215.14:443", nil); err != nil {
+		t.Errorf("dialControl(public address) = %v", err)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+	}
+	for addr, want := range tests {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddr(%s) = %t, want %t", addr, got, want)
+		}
+	}
+}
+
+func TestValidateOutboundURL(t *testing.T) {
+	for _, raw := range []string{
+		"file:///etc/passwd",
+		"gopher://example.com",
+		"http://",
+		"http://localhost:3000/",
+		"http://127.0.0.1/feed.ics",
+		"http://[::1]/feed.ics",
+		"http://10.0.0.5/feed.ics",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		if err := validateOutboundURL(raw); err == nil {
+			t.Errorf("validateOutboundURL(%q): expected an error", raw)
+		}
+	}
+}
+
+func TestFeedHorizonIsExtended(t *testing.T) {
+	content := []byte(`BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:focus
+SUMMARY:Focus time
+DTSTART:20260105T090000Z
+DTEND:20260105T110000Z
+RRULE:FREQ=DAILY
+END:VEVENT
+END:VCALENDAR
+`)
+	feed := db.CalendarFeed{ID: "test", Keywords: []string{"focus"}}
+	start := time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)
+	if !horizonDue(feed, start) {
+		t.Fatal("a feed without jobs should be due")
+	}
+
+	// Tick at the refresh interval for three weeks, generating the windows
+	// whenever the horizon is due, as syncFeed does for an unchanged feed
+	generated := make(map[time.Time]bool)
+	for now := start; now.Before(start.AddDate(0, 0, 21)); now = now.Add(feedRefreshInterval) {
+		if feed.HorizonAt != nil && feed.HorizonAt.Before(now.Add(feedHorizon-feedExtendAfter-feedRefreshInterval)) {
+			t.Fatalf("at %s the horizon is only %s", now, feed.HorizonAt)
+		}
+		if !horizonDue(feed, now) {
+			continue
+		}
+		windows, err := feedWindows(feed, content, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range windows {
+			generated[w.Start] = true
+		}
+		horizon := now.Add(feedHorizon)
+		feed.HorizonAt = &horizon
+	}
+	for day := start; day.Before(start.AddDate(0, 0, 21)); day = day.AddDate(0, 0, 1) {
+		if focus := day.Add(9 * time.Hour); !generated[focus] {
+			t.Errorf("no window generated for %s", focus)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// groupPrefix marks a channel group reference in a timer's channels,
+// e.g. "group:noisy-alerts".
+const groupPrefix = "group:"
+
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// errGroupInUse is returned when deleting a group that timers still use.
+var errGroupInUse = errors.New("channel group is used by timers")
+
+// channelGroups returns the channels of each of the user's groups by name.
+func channelGroups(email string) (map[string][]string, error) {
+	groups, err := db.GetChannelGroups(email)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]string, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group.Channels
+	}
+	return byName, nil
+}
+
+// expandChannels replaces group references with the group's channels and
+// drops duplicates. Groups that no longer exist expand to nothing.
+func expandChannels(channels []string, groups map[string][]string) []string {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(channel string) {
+		if !seen[channel] {
+			seen[channel] = true
+			expanded = append(expanded, channel)
+		}
+	}
+	for _, channel := range channels {
+		name, ok := strings.CutPrefix(channel, groupPrefix)
+		if !ok {
+			add(channel)
+			continue
+		}
+		members, found := groups[name]
+		if !found {
+			log.Printf("Ignoring unknown channel group %s", name)
+		}
+		for _, member := range members {
+			add(member)
+		}
+	}
+	return expanded
+}
+
+// usesGroup reports whether a timer references the named group.
+func usesGroup(timer db.Timing, name string) bool {
+	for _, channel := range timer.Channels {
+		if channel == groupPrefix+name {
+			return true
+		}
+	}
+	return false
+}
+
+// saveChannelGroup creates or replaces a group and regenerates the future
+// jobs of the timers using it.
+func saveChannelGroup(email string, name string, channels []string) (db.ChannelGroup, error) {
+	group := db.ChannelGroup{Email: email, Name: name, Channels: channels, UpdatedAt: time.Now()}
+	if err := db.SaveChannelGroup(group); err != nil {
+		return group, err
+	}
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		return group, err
+	}
+	for _, timer := range timers {
+		if !usesGroup(timer, name) {
+			continue
+		}
+		if err := rescheduleTimer(email, timer); err != nil {
+			return group, fmt.Errorf("error rescheduling timer %s: %w", timer.ID, err)
+		}
+	}
+	log.Printf("Saved channel group %s for user %s", name, email)
+	return group, nil
+}
+
+// removeChannelGroup deletes a group unless a timer still uses it.
+func removeChannelGroup(email string, name string) error {
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		return err
+	}
+	for _, timer := range timers {
+		if usesGroup(timer, name) {
+			return errGroupInUse
+		}
+	}
+	return db.RemoveChannelGroup(email, name)
+}
+
+// groupRequest is the JSON body of PUT /groups/:name:
+//
+//	{"channels": ["CT_1234", "#alerts"]}
+type groupRequest struct {
+	Channels []string `json:"channels"`
+}
+
+func (r groupRequest) validate() []fieldError {
+	if len(r.Channels) == 0 {
+		return []fieldError{{Field: "channels", Message: "must contain at least one channel"}}
+	}
+	var fields []fieldError
+	for i, channel := range r.Channels {
+		field := "channels[" + strconv.Itoa(i) + "]"
+		switch {
+		case strings.TrimSpace(channel) == "":
+			fields = append(fields, fieldError{Field: field, Message: "must not be empty"})
+		case strings.HasPrefix(channel, groupPrefix):
+			fields = append(fields, fieldError{Field: field, Message: "groups can't contain other groups"})
+		}
+	}
+	return fields
+}
+
+// listGroupsHandler lists the channel groups of the user.
+func listGroupsHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	groups, err := db.GetChannelGroups(email)
+	if err != nil {
+		log.Printf("Error listing channel groups for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list channel groups")
+	}
+	if groups == nil {
+		groups = []db.ChannelGroup{}
+	}
+	return c.Status(fiber.StatusOK).JSON(groups)
+}
+
+// getGroupHandler returns a single channel group of the user.
+func getGroupHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	group, err := db.GetChannelGroup(email, c.Params("name"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Channel group not found")
+		}
+		log.Printf("Error loading channel group %s for user %s: %v", c.Params("name"), email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load channel group")
+	}
+	return c.Status(fiber.StatusOK).JSON(group)
+}
+
+// putGroupHandler creates or replaces a channel group; timers using it are
+// rescheduled with the new channels.
+func putGroupHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	name := c.Params("name")
+	if !groupNamePattern.MatchString(name) {
+		return sendValidationError(c, []fieldError{{Field: "name", Message: "must be lowercase letters, digits, - or _, up to 64 characters"}})
+	}
+
+	var req groupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	channels, fields, err := resolveChannelRefs(email, req.Channels)
+	if err != nil {
+		log.Printf("Error resolving channels for user %s: %v", email, err)
+		return sendError(c, fiber.StatusBadGateway, "cliq_unavailable", "Failed to look up channel names in Cliq")
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	group, err := saveChannelGroup(email, name, channels)
+	if err != nil {
+		log.Printf("Error saving channel group %s for user %s: %v", name, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save channel group")
+	}
+	return c.Status(fiber.StatusOK).JSON(group)
+}
+
+// deleteGroupHandler deletes a channel group that no timer uses.
+func deleteGroupHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	name := c.Params("name")
+	if err := removeChannelGroup(email, name); err != nil {
+		switch {
+		case errors.Is(err, errGroupInUse):
+			return sendError(c, fiber.StatusConflict, "group_in_use", "Remove the group from its timers first")
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return sendError(c, fiber.StatusNotFound, "not_found", "Channel group not found")
+		}
+		log.Printf("Error deleting channel group %s for user %s: %v", name, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete channel group")
+	}
+	log.Printf("Deleted channel group %s for user %s", name, email)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// userEmail returns the email of the authenticated user, set by requireAuth.
+func userEmail(c *fiber.Ctx) string {
+	email, _ := c.Locals("email").(string)
+	return email
+}
+
+// createTimerHandler creates a timer and schedules its first window.
+func createTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	req, fields := parseTimerRequest(c)
+	if len(fields) == 0 {
+		fields = req.validate(false)
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	if fields, err := req.resolveChannels(email); err != nil {
+		log.Printf("Error resolving channels for user %s: %v", email, err)
+		return sendError(c, fiber.StatusBadGateway, "cliq_unavailable", "Failed to look up channel names in Cliq")
+	} else if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	timer := db.Timing{ID: uuid.New().String()}
+	req.apply(&timer)
+
+	scheduled, err := createTimer(email, timer)
+	if err != nil {
+		log.Printf("Error creating timer %s for user %s: %v", timer.ID, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save timer")
+	}
+	if !scheduled {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "One-time timer not scheduled, time already past."})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(timer)
+}
+
+// listTimersHandler lists the timers of the user with their next window.
+func listTimersHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error getting timers for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list timers")
+	}
+
+	type timerView struct {
+		db.Timing
+		NextMute   *time.Time `json:"next_mute,omitempty"`
+		NextUnmute *time.Time `json:"next_unmute,omitempty"`
+	}
+	views := make([]timerView, 0, len(timers))
+	now := time.Now()
+	for _, timer := range timers {
+		view := timerView{Timing: timer}
+		muteAt, unmuteAt, ok, err := nextWindow(withHolidaySkips(email, timer), now)
+		if err != nil {
+			log.Printf("Error computing next window of timer %s for user %s: %v", timer.ID, email, err)
+		} else if ok {
+			view.NextMute = &muteAt
+			view.NextUnmute = &unmuteAt
+		}
+		views = append(views, view)
+	}
+	return c.Status(fiber.StatusOK).JSON(views)
+}
+
+// listJobsHandler lists a page of the user's jobs matching the query filters.
+func listJobsHandler(c *fiber.Ctx) error {
+	return listJobs(c, userEmail(c))
+}
+
+// listJobs answers with a page of the jobs matching the query filters,
+// limited to a user's unless email is empty.
+func listJobs(c *fiber.Ctx, email string) error {
+	filter := db.JobFilter{
+		Email:     email,
+		Status:    strings.ToUpper(c.Query("status")),
+		TimerID:   c.Query("timer_id"),
+		ChannelID: c.Query("channel"),
+	}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return sendValidationError(c, []fieldError{{Field: "from", Message: "must be an RFC3339 time"}})
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return sendValidationError(c, []fieldError{{Field: "to", Message: "must be an RFC3339 time"}})
+		}
+	}
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 50)
+	if page < 1 {
+		return sendValidationError(c, []fieldError{{Field: "page", Message: "must be at least 1"}})
+	}
+	if limit < 1 || limit > 200 {
+		return sendValidationError(c, []fieldError{{Field: "limit", Message: "must be between 1 and 200"}})
+	}
+	filter.Skip = int64((page - 1) * limit)
+	filter.Limit = int64(limit)
+
+	jobs, total, err := db.FindJobs(filter)
+	if err != nil {
+		log.Printf("Error listing jobs (user %q): %v", filter.Email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list jobs")
+	}
+	if jobs == nil {
+		jobs = []db.Job{}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"jobs":  jobs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// updateTimerHandler changes the fields present in the request and
+// regenerates the future jobs of the timer.
+func updateTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+
+	req, fields := parseTimerRequest(c)
+	if len(fields) == 0 {
+		fields = req.validate(true)
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	if fields, err := req.resolveChannels(email); err != nil {
+		log.Printf("Error resolving channels for user %s: %v", email, err)
+		return sendError(c, fiber.StatusBadGateway, "cliq_unavailable", "Failed to look up channel names in Cliq")
+	} else if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	timer, err := updateTimer(email, id, req)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		if errors.Is(err, errManagedTimer) {
+			return sendError(c, fiber.StatusConflict, "managed_timer", "Timer is managed by a team policy")
+		}
+		log.Printf("Error updating timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to update timer")
+	}
+	return c.Status(fiber.StatusOK).JSON(timer)
+}
+
+// pauseTimerHandler pauses a timer, optionally until resume_at.
+func pauseTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+
+	var resumeAt *time.Time
+	if resumeStr := c.Query("resume_at"); resumeStr != "" {
+		t, err := time.Parse(time.RFC3339, resumeStr)
+		if err != nil {
+			return sendValidationError(c, []fieldError{{Field: "resume_at", Message: "must be an RFC3339 time"}})
+		}
+		if !t.After(time.Now()) {
+			return sendValidationError(c, []fieldError{{Field: "resume_at", Message: "must be in the future"}})
+		}
+		resumeAt = &t
+	}
+
+	timer, err := pauseTimer(email, id, resumeAt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		if errors.Is(err, errManagedTimer) {
+			return sendError(c, fiber.StatusConflict, "managed_timer", "Timer is managed by a team policy")
+		}
+		log.Printf("Error pausing timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to pause timer")
+	}
+	return c.Status(fiber.StatusOK).JSON(timer)
+}
+
+// resumeTimerHandler resumes a paused timer.
+func resumeTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+
+	timer, err := resumeTimer(email, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		log.Printf("Error resuming timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to resume timer")
+	}
+	return c.Status(fiber.StatusOK).JSON(timer)
+}
+
+// addExceptionHandler skips or shifts a single occurrence of a timer.
+func addExceptionHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+
+	req, fields := parseExceptionRequest(c)
+	if len(fields) == 0 {
+		fields = req.validate()
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	timer, err := addTimerException(email, id, req.exception())
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		if errors.Is(err, errManagedTimer) {
+			return sendError(c, fiber.StatusConflict, "managed_timer", "Timer is managed by a team policy")
+		}
+		log.Printf("Error adding exception to timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to add exception")
+	}
+	return c.Status(fiber.StatusCreated).JSON(timer)
+}
+
+// removeExceptionHandler removes the exception of a timer for a date.
+func removeExceptionHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+
+	timer, err := removeTimerException(email, id, c.Params("date"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		if errors.Is(err, errNoException) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer has no exception for this date")
+		}
+		if errors.Is(err, errManagedTimer) {
+			return sendError(c, fiber.StatusConflict, "managed_timer", "Timer is managed by a team policy")
+		}
+		log.Printf("Error removing exception from timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to remove exception")
+	}
+	return c.Status(fiber.StatusOK).JSON(timer)
+}
+
+// getTimerHandler returns a single timer of the user.
+func getTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	timer, err := db.GetTimer(email, c.Params("id"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		log.Printf("Error loading timer %s for user %s: %v", c.Params("id"), email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load timer")
+	}
+	return c.Status(fiber.StatusOK).JSON(timer)
+}
+
+// deleteTimerHandler removes a timer and its future jobs, unmuting the
+// channels of a window it is running.
+func deleteTimerHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	id := c.Params("id")
+	if err := stopTimer(email, id); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+		}
+		if errors.Is(err, errManagedTimer) {
+			return sendError(c, fiber.StatusConflict, "managed_timer", "Timer is managed by a team policy")
+		}
+		log.Printf("Error removing timer %s for user %s: %v", id, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete timer")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// getJobHandler returns a single job of the user.
+func getJobHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	job, err := db.GetJob(c.Params("id"))
+	if err != nil || job.Email != email {
+		if err == nil || errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Job not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load job")
+	}
+	return c.Status(fiber.StatusOK).JSON(job)
+}
+
+// getUserHandler returns the profile of the user, without OAuth secrets.
+func getUserHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	user, err := db.GetUser(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load user")
+	}
+	if user.Timers == nil {
+		user.Timers = []db.Timing{}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"email":      user.Email,
+		"timers":     user.Timers,
+		"holidays":   user.Holidays,
+		"auto_reply": user.AutoReply,
+	})
+}
+
+// listChannelsHandler lists the user's Cliq channels and chats, cached
+// unless refresh=true, with the timers using each one. Channels used by
+// timers that Cliq no longer lists are included without a name.
+func listChannelsHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	timers, err := db.GetTimers(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list channels")
+	}
+	cliqChannels, err := userChannels(email, c.QueryBool("refresh"))
+	if err != nil {
+		log.Printf("Error listing Cliq channels for user %s: %v", email, err)
+		return sendError(c, fiber.StatusBadGateway, "cliq_unavailable", "Failed to list channels in Cliq")
+	}
+
+	type channelView struct {
+		cliqChannel
+		TimerIDs []string `json:"timer_ids"`
+	}
+	channels := make([]channelView, 0, len(cliqChannels))
+	index := make(map[string]int)
+	for _, channel := range cliqChannels {
+		index[channel.ID] = len(channels)
+		channels = append(channels, channelView{cliqChannel: channel, TimerIDs: []string{}})
+	}
+	groups, err := channelGroups(email)
+	if err != nil {
+		log.Printf("Error loading channel groups for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list channels")
+	}
+	for _, timer := range timers {
+		for _, channel := range mutedChannels(timer, groups, cliqChannels) {
+			i, ok := index[channel]
+			if !ok {
+				i = len(channels)
+				index[channel] = i
+				channels = append(channels, channelView{cliqChannel: cliqChannel{ID: channel}})
+			}
+			channels[i].TimerIDs = append(channels[i].TimerIDs, timer.ID)
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(channels)
+}
+
+// tokenDiagnosticsHandler reports the health of a user's Zoho token without
+// ever returning it. With check=true the token is refreshed first.
+func tokenDiagnosticsHandler(c *fiber.Ctx) error {
+	email := c.Params("email")
+	audit(c, "token.diagnostics", email)
+
+	if c.QueryBool("check") {
+		// The fresh access token is discarded; only its health is recorded
+		if _, err := refreshAccessToken(email); err != nil {
+			log.Printf("Token check for %s failed: %v", email, err)
+		}
+	}
+
+	user, err := db.GetUser(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load user")
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"email":             user.Email,
+		"has_refresh_token": user.RefreshToken != "",
+		"health":            user.TokenHealth,
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// holidayRequest is the JSON body of PUT /holidays:
+//
+//	{
+//	  "calendar_id": "builtin:IN",   // imported calendar ID or builtin:<country>
+//	  "channels": ["CT_1234"],       // channels muted on holidays, at least one
+//	  "timezone": "Asia/Kolkata",    // IANA name the holiday dates are in
+//	  "suppress_timers": true        // skip the user's timers on holidays
+//	}
+type holidayRequest struct {
+	CalendarID     string   `json:"calendar_id"`
+	Channels       []string `json:"channels"`
+	Timezone       string   `json:"timezone"`
+	SuppressTimers bool     `json:"suppress_timers"`
+}
+
+// parseHolidayRequest reads a holidayRequest from a JSON body, falling back
+// to the deprecated query parameters (calendar_id, repeated channels,
+// timezone, suppress_timers).
+func parseHolidayRequest(c *fiber.Ctx) (holidayRequest, []fieldError) {
+	var req holidayRequest
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := c.BodyParser(&req); err != nil {
+			return req, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}}
+		}
+		return req, nil
+	}
+
+	c.Set("Deprecation", "true")
+	req.CalendarID = c.Query("calendar_id")
+	req.Timezone = c.Query("timezone")
+	for _, v := range c.Context().QueryArgs().PeekMulti("channels") {
+		req.Channels = append(req.Channels, string(v))
+	}
+	if v := c.Query("suppress_timers"); v != "" {
+		var err error
+		if req.SuppressTimers, err = strconv.ParseBool(v); err != nil {
+			return req, []fieldError{{Field: "suppress_timers", Message: "must be true or false"}}
+		}
+	}
+	return req, nil
+}
+
+func (r holidayRequest) validate() []fieldError {
+	var fields []fieldError
+	if r.CalendarID == "" {
+		fields = append(fields, fieldError{Field: "calendar_id", Message: "is required"})
+	} else if _, err := holidaysBetween(r.CalendarID, time.Now(), time.Now()); err != nil {
+		fields = append(fields, fieldError{Field: "calendar_id", Message: "must be an imported calendar or builtin:<country>"})
+	}
+	if len(r.Channels) == 0 {
+		fields = append(fields, fieldError{Field: "channels", Message: "must contain at least one channel"})
+	}
+	for i, channel := range r.Channels {
+		if strings.TrimSpace(channel) == "" {
+			fields = append(fields, fieldError{Field: "channels[" + strconv.Itoa(i) + "]", Message: "must not be empty"})
+		}
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil || r.Timezone == "" {
+		fields = append(fields, fieldError{Field: "timezone", Message: "must be an IANA timezone name"})
+	}
+	return fields
+}
+
+// listCountriesHandler lists the countries with built-in holidays.
+func listCountriesHandler(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(builtinCountries())
+}
+
+// createHolidayCalendarHandler imports a holiday calendar from an .ics file,
+// uploaded as multipart "file" or sent as the raw body. Calendars are shared
+// by all users, so only admins may import them.
+func createHolidayCalendarHandler(c *fiber.Ctx) error {
+	name := c.Query("name")
+	if name == "" {
+		return sendValidationError(c, []fieldError{{Field: "name", Message: "is required"}})
+	}
+
+	var r io.Reader = bytes.NewReader(c.Body())
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return sendValidationError(c, []fieldError{{Field: "file", Message: "could not be read"}})
+		}
+		defer f.Close()
+		r = f
+	}
+
+	calendar, err := importHolidayCalendar(name, r)
+	if err != nil {
+		return sendValidationError(c, []fieldError{{Field: "file", Message: "must be a valid iCalendar file with events"}})
+	}
+	calendar.ID = uuid.New().String()
+	if err := db.CreateHolidayCalendar(calendar); err != nil {
+		log.Printf("Error saving holiday calendar %s: %v", name, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save holiday calendar")
+	}
+	audit(c, "holidays.calendar.create", calendar.ID)
+	return c.Status(fiber.StatusCreated).JSON(calendar)
+}
+
+// getHolidaysHandler returns the user's holiday settings with the holidays
+// of the next 90 days.
+func getHolidaysHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	user, err := db.GetUser(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load holidays")
+	}
+	if user.Holidays == nil {
+		return sendError(c, fiber.StatusNotFound, "not_found", "No holiday calendar configured")
+	}
+
+	now := time.Now()
+	upcoming, err := holidaysBetween(user.Holidays.CalendarID, now, now.AddDate(0, 0, 90))
+	if err != nil {
+		log.Printf("Error loading holidays of user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load holidays")
+	}
+	if upcoming == nil {
+		upcoming = []db.Holiday{}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"settings": user.Holidays, "upcoming": upcoming})
+}
+
+// putHolidaysHandler associates a holiday calendar with the user and
+// regenerates their jobs.
+func putHolidaysHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	req, fields := parseHolidayRequest(c)
+	if len(fields) == 0 {
+		fields = req.validate()
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	channels, fields, err := resolveChannelRefs(email, req.Channels)
+	if err != nil {
+		log.Printf("Error resolving channels for user %s: %v", email, err)
+		return sendError(c, fiber.StatusBadGateway, "cliq_unavailable", "Failed to look up channel names in Cliq")
+	}
+	if len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	settings := db.HolidaySettings{
+		CalendarID:     req.CalendarID,
+		Channels:       channels,
+		Timezone:       req.Timezone,
+		SuppressTimers: req.SuppressTimers,
+	}
+	if err := db.SetHolidaySettings(email, &settings); err != nil {
+		log.Printf("Error saving holiday settings for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save holiday settings")
+	}
+	if err := rescheduleUser(email); err != nil {
+		log.Printf("Error rescheduling user %s after holiday change: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to reschedule timers")
+	}
+	return c.Status(fiber.StatusOK).JSON(settings)
+}
+
+// deleteHolidaysHandler removes the user's holiday calendar.
+func deleteHolidaysHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	if err := db.SetHolidaySettings(email, nil); err != nil {
+		log.Printf("Error removing holiday settings for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to remove holiday settings")
+	}
+	if err := rescheduleUser(email); err != nil {
+		log.Printf("Error rescheduling user %s after holiday change: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to reschedule timers")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
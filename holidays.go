@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/EthicalGopher/AfterWork_Buddy/ical"
+)
+
+const builtinCalendarPrefix = "builtin:"
+
+// builtinHolidays generates the public holidays of a country for a year.
+var builtinHolidays = map[string]func(year int) []db.Holiday{
+	"IN": func(year int) []db.Holiday {
+		return []db.Holiday{
+			holiday(year, time.January, 26, "Republic Day"),
+			holiday(year, time.August, 15, "Independence Day"),
+			holiday(year, time.October, 2, "Gandhi Jayanti"),
+		}
+	},
+	"US": func(year int) []db.Holiday {
+		return []db.Holiday{
+			holiday(year, time.January, 1, "New Year's Day"),
+			holidayOn(nthWeekday(year, time.January, time.Monday, 3), "Martin Luther King Jr. Day"),
+			holidayOn(nthWeekday(year, time.February, time.Monday, 3), "Presidents' Day"),
+			holidayOn(nthWeekday(year, time.May, time.Monday, -1), "Memorial Day"),
+			holiday(year, time.June, 19, "Juneteenth"),
+			holiday(year, time.July, 4, "Independence Day"),
+			holidayOn(nthWeekday(year, time.September, time.Monday, 1), "Labor Day"),
+			holidayOn(nthWeekday(year, time.October, time.Monday, 2), "Columbus Day"),
+			holiday(year, time.November, 11, "Veterans Day"),
+			holidayOn(nthWeekday(year, time.November, time.Thursday, 4), "Thanksgiving Day"),
+			holiday(year, time.December, 25, "Christmas Day"),
+		}
+	},
+	"GB": func(year int) []db.Holiday {
+		easter := easterSunday(year)
+		return []db.Holiday{
+			holiday(year, time.January, 1, "New Year's Day"),
+			holidayOn(easter.AddDate(0, 0, -2), "Good Friday"),
+			holidayOn(easter.AddDate(0, 0, 1), "Easter Monday"),
+			holidayOn(nthWeekday(year, time.May, time.Monday, 1), "Early May Bank Holiday"),
+			holidayOn(nthWeekday(year, time.May, time.Monday, -1), "Spring Bank Holiday"),
+			holidayOn(nthWeekday(year, time.August, time.Monday, -1), "Summer Bank Holiday"),
+			holiday(year, time.December, 25, "Christmas Day"),
+			holiday(year, time.December, 26, "Boxing Day"),
+		}
+	},
+	"DE": func(year int) []db.Holiday {
+		easter := easterSunday(year)
+		return []db.Holiday{
+			holiday(year, time.January, 1, "Neujahr"),
+			holidayOn(easter.AddDate(0, 0, -2), "Karfreitag"),
+			holidayOn(easter.AddDate(0, 0, 1), "Ostermontag"),
+			holiday(year, time.May, 1, "Tag der Arbeit"),
+			holidayOn(easter.AddDate(0, 0, 39), "Christi Himmelfahrt"),
+			holidayOn(easter.AddDate(0, 0, 50), "Pfingstmontag"),
+			holiday(year, time.October, 3, "Tag der Deutschen Einheit"),
+			holiday(year, time.December, 25, "1. Weihnachtstag"),
+			holiday(year, time.December, 26, "2. Weihnachtstag"),
+		}
+	},
+}
+
+func holiday(year int, month time.Month, day int, name string) db.Holiday {
+	return holidayOn(time.Date(year, month, day, 0, 0, 0, 0, time.UTC), name)
+}
+
+func holidayOn(date time.Time, name string) db.Holiday {
+	return db.Holiday{Date: date.Format("2006-01-02"), Name: name}
+}
+
+// nthWeekday returns the n-th weekday of a month; n = -1 is the last one.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -((int(last.Weekday()) - int(weekday) + 7) % 7))
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
+
+// easterSunday computes the date of Easter with the anonymous Gregorian algorithm.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := (19*a + b - b/4 - (b-(b+8)/25+1)/3 + 15) % 30
+	e := (32 + 2*(b%4) + 2*(c/4) - d - c%4) % 7
+	f := d + e - 7*((a+11*d+22*e)/451) + 114
+	return time.Date(year, time.Month(f/31), f%31+1, 0, 0, 0, 0, time.UTC)
+}
+
+// builtinCountries lists the country codes with a built-in holiday list.
+func builtinCountries() []string {
+	countries := make([]string, 0, len(builtinHolidays))
+	for country := range builtinHolidays {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// holidaysBetween returns the holidays of a calendar whose dates fall in
+// [from, to], sorted by date.
+func holidaysBetween(calendarID string, from, to time.Time) ([]db.Holiday, error) {
+	var all []db.Holiday
+	if country, ok := strings.CutPrefix(calendarID, builtinCalendarPrefix); ok {
+		generate, ok := builtinHolidays[strings.ToUpper(country)]
+		if !ok {
+			return nil, fmt.Errorf("no built-in holidays for country %q", country)
+		}
+		for year := from.Year(); year <= to.Year(); year++ {
+			all = append(all, generate(year)...)
+		}
+	} else {
+		calendar, err := db.GetHolidayCalendar(calendarID)
+		if err != nil {
+			return nil, err
+		}
+		all = calendar.Holidays
+	}
+
+	first, last := from.Format("2006-01-02"), to.Format("2006-01-02")
+	var holidays []db.Holiday
+	for _, h := range all {
+		if h.Date >= first && h.Date <= last {
+			holidays = append(holidays, h)
+		}
+	}
+	sort.Slice(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays, nil
+}
+
+// importHolidayCalendar reads the holidays of an iCalendar file. Every day
+// covered by an event becomes a holiday.
+func importHolidayCalendar(name string, r io.Reader) (*db.HolidayCalendar, error) {
+	events, err := ical.Parse(r, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &db.HolidayCalendar{Name: name}
+	seen := make(map[string]bool)
+	for _, event := range events {
+		start := time.Date(event.Start.Year(), event.Start.Month(), event.Start.Day(), 0, 0, 0, 0, time.UTC)
+		for day := start; day.Before(event.End) || day.Equal(start); day = day.AddDate(0, 0, 1) {
+			date := day.Format("2006-01-02")
+			if !seen[date] {
+				seen[date] = true
+				calendar.Holidays = append(calendar.Holidays, db.Holiday{Date: date, Name: event.Summary})
+			}
+		}
+	}
+	if len(calendar.Holidays) == 0 {
+		return nil, fmt.Errorf("calendar contains no events")
+	}
+	sort.Slice(calendar.Holidays, func(i, j int) bool { return calendar.Holidays[i].Date < calendar.Holidays[j].Date })
+	return calendar, nil
+}
+
+// holidayTimerID is the TimerID of the jobs generated from a user's holidays.
+func holidayTimerID(email string) string {
+	return "holidays-" + email
+}
+
+// materializeHolidayJobs stores and schedules all-day MUTE/UNMUTE jobs for
+// holidays of the user starting today or tomorrow; it runs every day, see
+// untilNextDay. Consecutive holidays are merged into one window, and channel
+// groups and patterns are expanded like a timer's.
+func materializeHolidayJobs(user db.User) error {
+	settings := user.Holidays
+	if settings == nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// Look a few days back so an ongoing multi-day holiday keeps its start
+	holidays, err := holidaysBetween(settings.CalendarID, today.AddDate(0, 0, -7), today.AddDate(0, 0, 14))
+	if err != nil {
+		return err
+	}
+
+	timerID := holidayTimerID(user.Email)
+	var channels []string
+	for i := 0; i < len(holidays); i++ {
+		muteAt, err := time.ParseInLocation("2006-01-02", holidays[i].Date, loc)
+		if err != nil {
+			return err
+		}
+		unmuteAt := muteAt.AddDate(0, 0, 1)
+		for i+1 < len(holidays) && holidays[i+1].Date == unmuteAt.Format("2006-01-02") {
+			unmuteAt = unmuteAt.AddDate(0, 0, 1)
+			i++
+		}
+		if !unmuteAt.After(now) || muteAt.After(today.AddDate(0, 0, 1)) {
+			continue
+		}
+
+		if channels == nil {
+			if channels, err = timerChannels(user.Email, db.Timing{ID: timerID, Channels: settings.Channels}); err != nil {
+				return err
+			}
+		}
+		scheduleWindowJobs(user.Email, timerID, channels, muteAt, unmuteAt)
+	}
+	return nil
+}
+
+// withHolidaySkips adds skip exceptions for the user's holidays to a timer
+// when the user suppresses normal timers on holidays. Exceptions set on the
+// timer itself take precedence.
+func withHolidaySkips(email string, timer db.Timing) db.Timing {
+	user, err := db.GetUser(email)
+	if err != nil || user.Holidays == nil || !user.Holidays.SuppressTimers {
+		return timer
+	}
+	now := time.Now()
+	holidays, err := holidaysBetween(user.Holidays.CalendarID, now.AddDate(0, 0, -1), now.AddDate(1, 0, 0))
+	if err != nil {
+		log.Printf("Error loading holidays of user %s: %v", email, err)
+		return timer
+	}
+
+	exceptions := make([]db.TimerException, 0, len(timer.Exceptions)+len(holidays))
+	exceptions = append(exceptions, timer.Exceptions...)
+	for _, h := range holidays {
+		exceptions = append(exceptions, db.TimerException{Date: h.Date, Skip: true})
+	}
+	timer.Exceptions = exceptions
+	return timer
+}
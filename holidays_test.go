@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinHolidays(t *testing.T) {
+	tests := []struct {
+		calendar string
+		date     string
+		name     string
+	}{
+		{"builtin:US", "2026-11-26", "Thanksgiving Day"},
+		{"builtin:US", "2026-05-25", "Memorial Day"},
+		{"builtin:GB", "2026-04-03", "Good Friday"},
+		{"builtin:de", "2026-05-14", "Christi Himmelfahrt"},
+		{"builtin:IN", "2026-01-26", "Republic Day"},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse("2006-01-02", tt.date)
+		holidays, err := holidaysBetween(tt.calendar, date, date)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.calendar, err)
+		}
+		if len(holidays) != 1 || holidays[0].Name != tt.name {
+			t.Errorf("%s on %s = %v, want %s", tt.calendar, tt.date, holidays, tt.name)
+		}
+	}
+
+	if _, err := holidaysBetween("builtin:XX", time.Now(), time.Now()); err == nil {
+		t.Error("expected an error for an unknown country")
+	}
+}
+
+func TestImportHolidayCalendar(t *testing.T) {
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:Company retreat",
+		"DTSTART;VALUE=DATE:20261230",
+		"DTEND;VALUE=DATE:20270102",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:New Year",
+		"DTSTART;VALUE=DATE:20270101",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Founders day",
+		"DTSTART;VALUE=DATE:20261201",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\n")
+
+	calendar, err := importHolidayCalendar("Company", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range calendar.Holidays {
+		got = append(got, h.Date+" "+h.Name)
+	}
+	want := []string{
+		"2026-12-01 Founders day",
+		"2026-12-30 Company retreat",
+		"2026-12-31 Company retreat",
+		"2027-01-01 Company retreat",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("holidays =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := importHolidayCalendar("Empty", strings.NewReader("BEGIN:VCALENDAR\nEND:VCALENDAR")); err == nil {
+		t.Error("expected an error for a calendar without events")
+	}
+}
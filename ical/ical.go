@@ -0,0 +1,293 @@
+// Package ical reads and writes the subset of iCalendar (RFC 5545) used by
+// AfterWork Buddy: VEVENTs with their dates, summary, categories and
+// recurrence.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a single VEVENT of a calendar.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	// AllDay events have DATE values; Start and End are midnights in the
+	// location passed to Parse, End being exclusive.
+	AllDay  bool
+	RRule   string
+	ExDates []time.Time
+	// RecurrenceID marks an event overriding one instance of the recurring
+	// event with the same UID.
+	RecurrenceID time.Time
+	// Cancelled events have STATUS:CANCELLED.
+	Cancelled bool
+}
+
+// property is one content line, e.g. DTSTART;TZID=Europe/Berlin:20260101T090000
+type property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Parse reads the VEVENTs of an iCalendar stream. Floating times and DATE
+// values are interpreted in loc.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var hasEnd bool
+	var duration time.Duration
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VEVENT"):
+			current = &Event{}
+			hasEnd = false
+			duration = 0
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, current.UID)
+			}
+			if !hasEnd {
+				switch {
+				case duration > 0:
+					current.End = current.Start.Add(duration)
+				case current.AllDay:
+					current.End = current.Start.AddDate(0, 0, 1)
+				default:
+					current.End = current.Start
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			// Properties outside events (VCALENDAR, VTIMEZONE, ...) are ignored
+		case prop.Name == "UID":
+			current.UID = prop.Value
+		case prop.Name == "SUMMARY":
+			current.Summary = unescape(prop.Value)
+		case prop.Name == "DESCRIPTION":
+			current.Description = unescape(prop.Value)
+		case prop.Name == "CATEGORIES":
+			for _, category := range splitEscaped(prop.Value) {
+				if category = strings.TrimSpace(category); category != "" {
+					current.Categories = append(current.Categories, category)
+				}
+			}
+		case prop.Name == "STATUS":
+			current.Cancelled = strings.EqualFold(prop.Value, "CANCELLED")
+		case prop.Name == "RRULE":
+			current.RRule = prop.Value
+		case prop.Name == "EXDATE":
+			for _, value := range strings.Split(prop.Value, ",") {
+				exdate, _, err := parseTime(property{Name: prop.Name, Params: prop.Params, Value: value}, loc)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				current.ExDates = append(current.ExDates, exdate)
+			}
+		case prop.Name == "RECURRENCE-ID":
+			current.RecurrenceID, _, err = parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case prop.Name == "DTSTART":
+			current.Start, current.AllDay, err = parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case prop.Name == "DTEND":
+			current.End, _, err = parseTime(prop, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			hasEnd = true
+		case prop.Name == "DURATION":
+			duration, err = ParseDuration(prop.Value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		}
+	}
+	return events, nil
+}
+
+// unfold joins folded content lines (continuations start with a space or tab).
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseLine(line string) (property, error) {
+	prop := property{Params: map[string]string{}}
+
+	// The value starts at the first colon that isn't inside a quoted parameter
+	inQuotes := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+		if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	prop.Value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func parseTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	value := prop.Value
+	if prop.Params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s date %q", prop.Name, value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid %s time %q", prop.Name, value)
+		}
+		return t, false, nil
+	}
+
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		tzLoc, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown TZID %q", tzid)
+		}
+		loc = tzLoc
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return t, false, fmt.Errorf("invalid %s time %q", prop.Name, value)
+	}
+	return t, false, nil
+}
+
+// ParseDuration parses an iCalendar duration such as "PT1H30M" or "P1D".
+func ParseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	num := 0
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num = num*10 + int(r-'0')
+			digits++
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+		if digits == 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		switch {
+		case r == 'W' && !inTime:
+			d += time.Duration(num) * 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			d += time.Duration(num) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(num) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(num) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(num) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		num, digits = 0, 0
+	}
+	if digits != 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * d, nil
+}
+
+// splitEscaped splits a list value on commas that aren't backslash-escaped.
+func splitEscaped(value string) []string {
+	var parts []string
+	var b strings.Builder
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			parts = append(parts, unescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(parts, unescape(b.String()))
+}
+
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
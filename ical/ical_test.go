@@ -0,0 +1,155 @@
+package ical
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParse(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	kolkata := mustLoad(t, "Asia/Kolkata")
+
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:focus-1",
+		"SUMMARY:Focus\\, deep work",
+		"DESCRIPTION:Line one\\nline two",
+		"CATEGORIES:Focus,Work\\,Internal",
+		"DTSTART;TZID=Europe/Berlin:20260105T090000",
+		"DTEND;TZID=Europe/Berlin:20260105T103000",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE",
+		"EXDATE;TZID=Europe/Berlin:20260107T090000,20260112T090000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:ooo",
+		"SUMMARY:Out of office",
+		"DTSTART;VALUE=DATE:20260120",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:utc",
+		"SUMMARY:A very long summary that is folded onto a continuation line by t",
+		" he exporting calendar",
+		"DTSTART:20260201T120000Z",
+		"DURATION:PT45M",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:focus-1",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20260114T090000",
+		"DTSTART:20260114T140000",
+		"DTEND:20260114T150000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := Parse(strings.NewReader(input), kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+
+	focus := events[0]
+	if focus.UID != "focus-1" || focus.Summary != "Focus, deep work" || focus.Description != "Line one\nline two" {
+		t.Errorf("focus text = %q %q %q", focus.UID, focus.Summary, focus.Description)
+	}
+	if !slices.Equal(focus.Categories, []string{"Focus", "Work,Internal"}) {
+		t.Errorf("focus categories = %q", focus.Categories)
+	}
+	if want := time.Date(2026, 1, 5, 9, 0, 0, 0, berlin); !focus.Start.Equal(want) {
+		t.Errorf("focus start = %s, want %s", focus.Start, want)
+	}
+	if want := time.Date(2026, 1, 5, 10, 30, 0, 0, berlin); !focus.End.Equal(want) {
+		t.Errorf("focus end = %s, want %s", focus.End, want)
+	}
+	if focus.RRule != "FREQ=WEEKLY;BYDAY=MO,WE" || len(focus.ExDates) != 2 {
+		t.Errorf("focus rrule = %q, exdates = %v", focus.RRule, focus.ExDates)
+	}
+
+	ooo := events[1]
+	if !ooo.AllDay || !ooo.Start.Equal(time.Date(2026, 1, 20, 0, 0, 0, 0, kolkata)) || !ooo.End.Equal(time.Date(2026, 1, 21, 0, 0, 0, 0, kolkata)) {
+		t.Errorf("all-day event = %+v", ooo)
+	}
+
+	utc := events[2]
+	if !strings.HasSuffix(utc.Summary, "by the exporting calendar") {
+		t.Errorf("folded summary = %q", utc.Summary)
+	}
+	if want := time.Date(2026, 2, 1, 12, 45, 0, 0, time.UTC); !utc.End.Equal(want) {
+		t.Errorf("duration end = %s, want %s", utc.End, want)
+	}
+
+	override := events[3]
+	if want := time.Date(2026, 1, 14, 9, 0, 0, 0, berlin); !override.RecurrenceID.Equal(want) {
+		t.Errorf("recurrence id = %s, want %s", override.RecurrenceID, want)
+	}
+	// Floating times are in the location passed to Parse
+	if want := time.Date(2026, 1, 14, 14, 0, 0, 0, kolkata); !override.Start.Equal(want) {
+		t.Errorf("floating start = %s, want %s", override.Start, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"no colon", "BEGIN:VEVENT\nDTSTART\nEND:VEVENT", "line 2: malformed content line"},
+		{"no start", "BEGIN:VEVENT\nUID:x\nEND:VEVENT", `event "x" has no DTSTART`},
+		{"end without begin", "END:VEVENT", "END:VEVENT without BEGIN"},
+		{"bad date", "BEGIN:VEVENT\nDTSTART:2026-01-01\nEND:VEVENT", "invalid DTSTART"},
+		{"bad tzid", "BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus:20260101T090000\nEND:VEVENT", "unknown TZID"},
+		{"bad duration", "BEGIN:VEVENT\nDTSTART:20260101T090000Z\nDURATION:1H\nEND:VEVENT", "invalid duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input), time.UTC)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"-PT15M", -15 * time.Minute, true},
+		{"+PT10S", 10 * time.Second, true},
+		{"PT", 0, true},
+		{"1H", 0, false},
+		{"PTH", 0, false},
+		{"P1H", 0, false},
+		{"PT5", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, ok %t", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Occurrence is one instance of a possibly recurring event.
+type Occurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// maxOccurrences bounds the expansion of a single rule.
+const maxOccurrences = 100000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Occurrences expands the event into the instances overlapping [from, to).
+// RRULEs with FREQ=DAILY, WEEKLY (optionally with BYDAY) and YEARLY are
+// supported, along with INTERVAL, COUNT and UNTIL. Other rules yield the
+// first instance only.
+func (e Event) Occurrences(from, to time.Time) ([]Occurrence, error) {
+	length := e.End.Sub(e.Start)
+	var starts []time.Time
+	if e.RRule == "" {
+		starts = []time.Time{e.Start}
+	} else {
+		var err error
+		starts, err = expand(e.Start, e.RRule, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var occurrences []Occurrence
+	for _, start := range starts {
+		if e.excluded(start) {
+			continue
+		}
+		end := start.Add(length)
+		if e.AllDay {
+			// Keep all-day instances on local midnights across DST changes
+			end = start.AddDate(0, 0, int(length.Round(24*time.Hour)/(24*time.Hour)))
+		}
+		if end.After(from) && start.Before(to) {
+			occurrences = append(occurrences, Occurrence{Start: start, End: end})
+		}
+	}
+	return occurrences, nil
+}
+
+// ApplyOverrides resolves the RECURRENCE-ID overrides of recurring events:
+// each overridden instance is excluded from its series and the override is
+// kept as a single event, inheriting the summary and categories of the
+// series if it has none. Cancelled events, whether series or overrides, are
+// dropped.
+func ApplyOverrides(events []Event) []Event {
+	series := make(map[string]int)
+	overridden := make(map[string][]time.Time)
+	for i, event := range events {
+		if event.RecurrenceID.IsZero() {
+			if event.RRule != "" {
+				series[event.UID] = i
+			}
+			continue
+		}
+		overridden[event.UID] = append(overridden[event.UID], event.RecurrenceID)
+	}
+
+	var resolved []Event
+	for _, event := range events {
+		if !event.RecurrenceID.IsZero() {
+			if i, ok := series[event.UID]; ok {
+				if event.Summary == "" {
+					event.Summary = events[i].Summary
+				}
+				if len(event.Categories) == 0 {
+					event.Categories = events[i].Categories
+				}
+			}
+		} else if event.RRule != "" && len(overridden[event.UID]) > 0 {
+			event.ExDates = append(append([]time.Time(nil), event.ExDates...), overridden[event.UID]...)
+		}
+		if !event.Cancelled {
+			resolved = append(resolved, event)
+		}
+	}
+	return resolved
+}
+
+func (e Event) excluded(start time.Time) bool {
+	for _, exdate := range e.ExDates {
+		if exdate.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand lists the start times of a recurrence rule up to the given time.
+func expand(dtstart time.Time, rrule string, to time.Time) ([]time.Time, error) {
+	rule := make(map[string]string)
+	for _, part := range strings.Split(rrule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		rule[strings.ToUpper(key)] = value
+	}
+
+	interval := 1
+	if v, ok := rule["INTERVAL"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RRULE INTERVAL %q", v)
+		}
+		interval = n
+	}
+	count := maxOccurrences
+	if v, ok := rule["COUNT"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RRULE COUNT %q", v)
+		}
+		count = min(n, maxOccurrences)
+	}
+	until := to
+	if v, ok := rule["UNTIL"]; ok {
+		t, _, err := parseTime(property{Name: "UNTIL", Value: v}, dtstart.Location())
+		if err != nil {
+			return nil, err
+		}
+		if t.Before(until) {
+			until = t
+		}
+	}
+
+	var byDay []time.Weekday
+	if v, ok := rule["BYDAY"]; ok {
+		for _, day := range strings.Split(v, ",") {
+			weekday, ok := weekdays[strings.ToUpper(day)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported RRULE BYDAY %q", day)
+			}
+			byDay = append(byDay, weekday)
+		}
+	}
+
+	var starts []time.Time
+	add := func(t time.Time) bool {
+		if t.After(until) || len(starts) >= count {
+			return false
+		}
+		if !t.Before(dtstart) {
+			starts = append(starts, t)
+		}
+		return true
+	}
+
+	switch strings.ToUpper(rule["FREQ"]) {
+	case "DAILY":
+		for i := 0; add(dtstart.AddDate(0, 0, i*interval)); i++ {
+		}
+	case "WEEKLY":
+		if len(byDay) == 0 {
+			for i := 0; add(dtstart.AddDate(0, 0, 7*i*interval)); i++ {
+			}
+			break
+		}
+		// Walk the weeks starting at the Monday-based week of DTSTART
+		weekStart := dtstart.AddDate(0, 0, -((int(dtstart.Weekday()) + 6) % 7))
+	weeks:
+		for week := 0; ; week += interval {
+			for _, weekday := range orderedFromMonday(byDay) {
+				if !add(weekStart.AddDate(0, 0, 7*week+(int(weekday)+6)%7)) {
+					break weeks
+				}
+			}
+		}
+	case "YEARLY":
+		for i := 0; add(dtstart.AddDate(i*interval, 0, 0)); i++ {
+		}
+	default:
+		starts = []time.Time{dtstart}
+	}
+	return starts, nil
+}
+
+// orderedFromMonday sorts weekdays in ISO order, matching the default WKST.
+func orderedFromMonday(days []time.Weekday) []time.Weekday {
+	ordered := make([]time.Weekday, 0, len(days))
+	for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		for _, day := range days {
+			if day == weekday {
+				ordered = append(ordered, weekday)
+				break
+			}
+		}
+	}
+	return ordered
+}
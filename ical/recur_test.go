@@ -0,0 +1,173 @@
+package ical
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrences(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, berlin)
+	}
+	// Monday 2026-01-05, 09:00-10:00
+	base := Event{Start: at(1, 5, 9), End: at(1, 5, 10)}
+
+	tests := []struct {
+		name     string
+		rrule    string
+		exdates  []time.Time
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name: "single",
+			from: at(1, 1, 0), to: at(2, 1, 0),
+			want: []time.Time{at(1, 5, 9)},
+		},
+		{
+			name: "single outside range",
+			from: at(1, 6, 0), to: at(2, 1, 0),
+		},
+		{
+			name:  "daily with count",
+			rrule: "FREQ=DAILY;COUNT=3",
+			from:  at(1, 1, 0), to: at(2, 1, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 6, 9), at(1, 7, 9)},
+		},
+		{
+			name:  "daily interval clipped to range",
+			rrule: "FREQ=DAILY;INTERVAL=2",
+			from:  at(1, 8, 0), to: at(1, 12, 0),
+			want: []time.Time{at(1, 9, 9), at(1, 11, 9)},
+		},
+		{
+			name:  "daily until",
+			rrule: "FREQ=DAILY;UNTIL=20260107T080000Z",
+			from:  at(1, 1, 0), to: at(2, 1, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 6, 9), at(1, 7, 9)},
+		},
+		{
+			name:    "daily with exdate",
+			rrule:   "FREQ=DAILY;COUNT=3",
+			exdates: []time.Time{at(1, 6, 9)},
+			from:    at(1, 1, 0), to: at(2, 1, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 7, 9)},
+		},
+		{
+			name:  "weekly",
+			rrule: "FREQ=WEEKLY",
+			from:  at(1, 1, 0), to: at(1, 20, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 12, 9), at(1, 19, 9)},
+		},
+		{
+			name:  "weekly by day",
+			rrule: "FREQ=WEEKLY;BYDAY=FR,MO",
+			from:  at(1, 1, 0), to: at(1, 13, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 9, 9), at(1, 12, 9)},
+		},
+		{
+			name:  "biweekly by day with count",
+			rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU;COUNT=3",
+			from:  at(1, 1, 0), to: at(3, 1, 0),
+			want: []time.Time{at(1, 5, 9), at(1, 6, 9), at(1, 19, 9)},
+		},
+		{
+			name:  "across DST keeps wall-clock time",
+			rrule: "FREQ=WEEKLY",
+			from:  at(3, 20, 0), to: at(4, 1, 0),
+			want: []time.Time{at(3, 23, 9), at(3, 30, 9)},
+		},
+		{
+			name:  "unsupported frequency yields first instance",
+			rrule: "FREQ=MONTHLY",
+			from:  at(1, 1, 0), to: at(6, 1, 0),
+			want: []time.Time{at(1, 5, 9)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := base
+			event.RRule = tt.rrule
+			event.ExDates = tt.exdates
+			got, err := event.Occurrences(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %v", len(got), got, tt.want)
+			}
+			for i, occurrence := range got {
+				if !occurrence.Start.Equal(tt.want[i]) || occurrence.End.Sub(occurrence.Start) != time.Hour {
+					t.Errorf("occurrence %d = %s-%s, want start %s", i, occurrence.Start, occurrence.End, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOccurrencesYearlyAllDay(t *testing.T) {
+	event := Event{
+		Start:  time.Date(2024, time.December, 25, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2024, time.December, 26, 0, 0, 0, 0, time.UTC),
+		AllDay: true,
+		RRule:  "FREQ=YEARLY",
+	}
+	got, err := event.Occurrences(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Start.Year() != 2026 || got[1].Start.Year() != 2027 {
+		t.Fatalf("got %v, want Christmas 2026 and 2027", got)
+	}
+	if !got[0].End.Equal(time.Date(2026, time.December, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("end = %s, want the next midnight", got[0].End)
+	}
+}
+
+func TestOccurrencesInvalidRule(t *testing.T) {
+	for _, rrule := range []string{"FREQ=DAILY;INTERVAL=0", "FREQ=DAILY;COUNT=x", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=DAILY;UNTIL=soon"} {
+		event := Event{Start: time.Now(), End: time.Now().Add(time.Hour), RRule: rrule}
+		if _, err := event.Occurrences(time.Now(), time.Now().Add(24*time.Hour)); err == nil {
+			t.Errorf("%s: expected an error", rrule)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2026, time.January, d, hour, 0, 0, 0, time.UTC) }
+	events := []Event{
+		{UID: "a", Summary: "Focus", Categories: []string{"Focus"}, Start: day(5, 9), End: day(5, 10), RRule: "FREQ=DAILY;COUNT=4", ExDates: []time.Time{day(8, 9)}},
+		{UID: "a", RecurrenceID: day(6, 9), Start: day(6, 15), End: day(6, 16)},
+		{UID: "a", RecurrenceID: day(7, 9), Start: day(7, 9), End: day(7, 10), Cancelled: true},
+		{UID: "b", Summary: "Cancelled series", Start: day(5, 12), End: day(5, 13), RRule: "FREQ=DAILY", Cancelled: true},
+	}
+
+	resolved := ApplyOverrides(events)
+	if len(resolved) != 2 {
+		t.Fatalf("got %d events, want the series and one override", len(resolved))
+	}
+	if len(events[0].ExDates) != 1 {
+		t.Error("ApplyOverrides modified the ExDates of its input")
+	}
+
+	var starts []time.Time
+	for _, event := range resolved {
+		occurrences, err := event.Occurrences(day(1, 0), day(31, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range occurrences {
+			starts = append(starts, o.Start)
+		}
+	}
+	want := []time.Time{day(5, 9), day(6, 15)}
+	if len(starts) != len(want) || !starts[0].Equal(want[0]) || !starts[1].Equal(want[1]) {
+		t.Errorf("starts = %v, want %v", starts, want)
+	}
+
+	override := resolved[1]
+	if override.Summary != "Focus" || len(override.Categories) != 1 {
+		t.Errorf("override didn't inherit the series' summary and categories: %+v", override)
+	}
+}
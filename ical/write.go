@@ -0,0 +1,197 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Calendar is a VCALENDAR to render with Write.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Write renders the calendar, including a VTIMEZONE for every location
+// used by its events.
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", escape(cal.ProdID))
+	line("CALSCALE", "GREGORIAN")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escape(cal.Name))
+	}
+
+	for _, loc := range locations(cal.Events) {
+		writeTimezone(bw, loc, cal.Events)
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, event := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(event.UID))
+		line("DTSTAMP", stamp)
+		writeFolded(bw, formatTime("DTSTART", event.Start, event.AllDay))
+		writeFolded(bw, formatTime("DTEND", event.End, event.AllDay))
+		if !event.RecurrenceID.IsZero() {
+			writeFolded(bw, formatTime("RECURRENCE-ID", event.RecurrenceID, event.AllDay))
+		}
+		if event.RRule != "" {
+			line("RRULE", event.RRule)
+		}
+		for _, exdate := range event.ExDates {
+			writeFolded(bw, formatTime("EXDATE", exdate, event.AllDay))
+		}
+		line("SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if len(event.Categories) > 0 {
+			categories := make([]string, len(event.Categories))
+			for i, category := range event.Categories {
+				categories[i] = escape(category)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+func formatTime(name string, t time.Time, allDay bool) string {
+	switch {
+	case allDay:
+		return name + ";VALUE=DATE:" + t.Format("20060102")
+	case t.Location() == time.UTC:
+		return name + ":" + t.Format("20060102T150405Z")
+	default:
+		return name + ";TZID=" + t.Location().String() + ":" + t.Format("20060102T150405")
+	}
+}
+
+// locations returns the non-UTC locations of the events' times.
+func locations(events []Event) []*time.Location {
+	seen := make(map[string]*time.Location)
+	for _, event := range events {
+		if loc := event.Start.Location(); loc != time.UTC && !event.AllDay {
+			seen[loc.String()] = loc
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	locs := make([]*time.Location, len(names))
+	for i, name := range names {
+		locs[i] = seen[name]
+	}
+	return locs
+}
+
+// writeTimezone renders a VTIMEZONE listing the UTC offset transitions of
+// loc from the year before the earliest event to two years after the latest.
+func writeTimezone(w *bufio.Writer, loc *time.Location, events []Event) {
+	var first, last time.Time
+	for _, event := range events {
+		if event.Start.Location().String() != loc.String() {
+			continue
+		}
+		if first.IsZero() || event.Start.Before(first) {
+			first = event.Start
+		}
+		if last.IsZero() || event.Start.After(last) {
+			last = event.Start
+		}
+	}
+	from := time.Date(first.Year()-1, time.January, 1, 0, 0, 0, 0, loc)
+	to := time.Date(last.Year()+3, time.January, 1, 0, 0, 0, 0, loc)
+
+	writeFolded(w, "BEGIN:VTIMEZONE")
+	writeFolded(w, "TZID:"+loc.String())
+
+	name, offset := from.Zone()
+	writeObservance(w, from.IsDST(), from.UTC().Add(time.Duration(offset)*time.Second), name, offset, offset)
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			transition := findTransition(t, next)
+			name, nextOffset = transition.Zone()
+			// DTSTART is the wall-clock time in the offset before the transition
+			wallClock := transition.UTC().Add(time.Duration(offset) * time.Second)
+			writeObservance(w, transition.IsDST(), wallClock, name, offset, nextOffset)
+			offset = nextOffset
+		}
+		t = next
+	}
+	writeFolded(w, "END:VTIMEZONE")
+}
+
+// findTransition returns the first instant in (from, to] whose offset
+// differs from the one at from.
+func findTransition(from, to time.Time) time.Time {
+	_, offset := from.Zone()
+	for to.Sub(from) > time.Second {
+		mid := from.Add(to.Sub(from) / 2)
+		if _, midOffset := mid.Zone(); midOffset == offset {
+			from = mid
+		} else {
+			to = mid
+		}
+	}
+	return to.Truncate(time.Second)
+}
+
+func writeObservance(w *bufio.Writer, dst bool, start time.Time, name string, offsetFrom, offsetTo int) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	writeFolded(w, "BEGIN:"+kind)
+	writeFolded(w, "DTSTART:"+start.Format("20060102T150405"))
+	writeFolded(w, "TZOFFSETFROM:"+formatOffset(offsetFrom))
+	writeFolded(w, "TZOFFSETTO:"+formatOffset(offsetTo))
+	writeFolded(w, "TZNAME:"+escape(name))
+	writeFolded(w, "END:"+kind)
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// writeFolded writes a content line, folding it at 75 octets without
+// splitting UTF-8 sequences.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the folding space
+		limit = 74
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(value)
+}
@@ -1,19 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/EthicalGopher/AfterWork_Buddy/db"
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func init() {
@@ -23,14 +24,20 @@ func init() {
 	}
 }
 
+// oauthScopes are requested from Zoho; AaaServer.profile.READ identifies the
+// user completing the OAuth flow, the Cliq profile scopes cover statuses and
+// ZohoCliq.Webhooks.CREATE and ZohoCliq.Messages.READ let us post and read
+// messages as the user.
+const oauthScopes = "ZohoCliq.Chats.UPDATE,ZohoCliq.Channels.CREATE,ZohoCliq.Channels.READ,ZohoCliq.Channels.UPDATE,ZohoCliq.Channels.DELETE,ZohoCliq.Profile.READ,ZohoCliq.Profile.UPDATE,ZohoCliq.Webhooks.CREATE,ZohoCliq.Messages.READ,AaaServer.profile.READ"
+
 var (
 	hostUrl = "https://afterwork-buddy.onrender.com"
 	// runningTimers and timersMutex are removed as per new job-based system
 )
 
-func muteChannel(accessToken string, channelId string) error {
+func muteChannel(ctx context.Context, accessToken string, channelId string) error {
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", "https://cliq.zoho.com/api/v2/chats/"+channelId+"/mute", nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", cliqAPIURL("/chats/"+channelId+"/mute"), nil)
 	if err != nil {
 		log.Printf("Error creating mute request: %v", err)
 		return err
@@ -52,9 +59,9 @@ func muteChannel(accessToken string, channelId string) error {
 	return nil
 }
 
-func unmuteChannel(accessToken string, channelId string) error {
+func unmuteChannel(ctx context.Context, accessToken string, channelId string) error {
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", "https://cliq.zoho.com/api/v2/chats/"+channelId+"/unmute", nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", cliqAPIURL("/chats/"+channelId+"/unmute"), nil)
 	if err != nil {
 		log.Printf("Error creating unmute request: %v", err)
 		return err
@@ -81,62 +88,130 @@ func refreshAccessToken(email string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error getting refresh token for %s: %w", email, err)
 	}
-	var newBody struct {
-		AccessToken string `json:"access_token"`
-		Error       string `json:"error"`
+	token, err := exchangeRefreshToken(body)
+	recordTokenHealth(email, token, err)
+	if err != nil {
+		return "", err
 	}
-	data := strings.Split(body.State, "and")
-	reqBody := `refresh_token=` + body.RefreshToken + `&grant_type=refresh_token&scope=ZohoCliq.Chats.UPDATE,ZohoCliq.Channels.CREATE,ZohoCliq.Channels.READ,ZohoCliq.Channels.UPDATE,ZohoCliq.Channels.DELETE&client_id=` + data[0] + `&client_secret=` + data[1] + `&redirect_uri=` + hostUrl + `/callback`
+	return token.AccessToken, nil
+}
+
+// tokenResponse is the response of Zoho's token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+}
+
+func exchangeRefreshToken(user db.User) (tokenResponse, error) {
+	var newBody tokenResponse
+	data := strings.Split(user.State, "and")
+	reqBody := `refresh_token=` + user.RefreshToken + `&grant_type=refresh_token&scope=` + oauthScopes + `&client_id=` + data[0] + `&client_secret=` + data[1] + `&redirect_uri=` + hostUrl + `/callback`
 	resp, err := http.Post(
 		"https://accounts.zoho.com/oauth/v2/token",
 		"application/x-www-form-urlencoded",
 		strings.NewReader(reqBody),
 	)
 	if err != nil {
-		return "", fmt.Errorf("error posting refresh token request: %w", err)
+		return newBody, fmt.Errorf("error posting refresh token request: %w", err)
 	}
 	defer resp.Body.Close()
 	dataByte, _ := io.ReadAll(resp.Body)
 	if err := json.Unmarshal(dataByte, &newBody); err != nil {
-		return "", fmt.Errorf("error unmarshalling refresh token response: %w", err)
+		return newBody, fmt.Errorf("error unmarshalling refresh token response: %w", err)
 	}
 	if newBody.Error != "" {
-		return "", fmt.Errorf("error refreshing token for %s: %s", email, newBody.Error)
+		return newBody, fmt.Errorf("error refreshing token for %s: %s", user.Email, newBody.Error)
+	}
+	return newBody, nil
+}
+
+// recordTokenHealth stores the outcome of a token refresh for diagnostics.
+// The access token itself is never stored.
+func recordTokenHealth(email string, token tokenResponse, refreshErr error) {
+	now := time.Now()
+	health := db.TokenHealth{LastRefreshAt: &now}
+	if current, err := db.GetUser(email); err == nil && current.TokenHealth != nil {
+		health = *current.TokenHealth
+		health.LastRefreshAt = &now
+	}
+
+	if refreshErr != nil {
+		health.Valid = false
+		health.LastError = refreshErr.Error()
+		health.LastErrorAt = &now
+	} else {
+		expiresAt := now.Add(time.Duration(token.ExpiresIn) * time.Second)
+		health.Valid = true
+		health.ExpiresAt = &expiresAt
+		health.Scopes = strings.FieldsFunc(token.Scope, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(health.Scopes) == 0 {
+			health.Scopes = strings.Split(oauthScopes, ",")
+		}
+	}
+	if err := db.SetTokenHealth(email, health); err != nil {
+		log.Printf("Error recording token health for %s: %v", email, err)
 	}
-	return newBody.AccessToken, nil
 }
 
-// executeJob performs the actual mute/unmute action and marks the job complete
+// executeJob runs the registered action of a job and marks the job complete.
+// A window-starting job that was cancelled while its action ran is
+// compensated, so a cancelled window doesn't leave channels muted.
 func executeJob(job db.Job) {
-	log.Printf("Executing job ID %s: Type=%s, Channel=%s, User=%s", job.ID, job.TaskType, job.ChannelID, job.Email)
+	// The job may have been cancelled or regenerated since it was scheduled in memory
+	current, err := db.GetJob(job.ID)
+	if err != nil || current.Status != "PENDING" || !current.ExecuteAt.Equal(job.ExecuteAt) {
+		log.Printf("Skipping job %s: no longer pending at %s", job.ID, job.ExecuteAt.Format(time.RFC3339))
+		return
+	}
+	// The stored job may carry payload written after it was scheduled
+	job = current
+
+	// Jobs of disabled accounts are dropped, except those ending a window
+	if user, err := db.GetUser(job.Email); err == nil && user.Disabled {
+		if _, isEnd := windowEndTasks[job.TaskType]; !isEnd {
+			log.Printf("Skipping job %s: account %s is disabled", job.ID, job.Email)
+			_ = db.CompleteJob(job.ID)
+			return
+		}
+	}
 
-	accessToken, err := refreshAccessToken(job.Email)
-	if err != nil {
-		log.Printf("Failed to refresh access token for user %s, job %s: %v", job.Email, job.ID, err)
-		// Optionally, re-schedule the job for a retry later, or mark as failed
+	action, ok := jobActions[job.TaskType]
+	if !ok {
+		// Fail rather than complete the job so it doesn't pass for done
+		err := checkTaskTypes(job.TaskType)
+		log.Printf("Failing job %s: %v", job.ID, err)
+		if err := db.FailJob(job.ID); err != nil {
+			log.Printf("Failed to mark job %s as failed: %v", job.ID, err)
+		}
+		go notifyJobResult(job, err)
 		return
 	}
+	log.Printf("Executing job ID %s: Type=%s, Channel=%s, User=%s", job.ID, job.TaskType, job.ChannelID, job.Email)
 
-	var actionErr error
-	if job.TaskType == "MUTE" {
-		actionErr = muteChannel(accessToken, job.ChannelID)
-	} else if job.TaskType == "UNMUTE" {
-		actionErr = unmuteChannel(accessToken, job.ChannelID)
-	} else {
-		log.Printf("Unknown job type for job %s: %s", job.ID, job.TaskType)
-		_ = db.CompleteJob(job.ID) // Mark as complete to avoid re-processing unknown types
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout(action))
+	defer cancel()
+	if err := action.Execute(ctx, job); err != nil {
+		log.Printf("Failed to perform %s action for job %s (channel %s, user %s): %v", job.TaskType, job.ID, job.ChannelID, job.Email, err)
+		go notifyJobResult(job, err)
 		return
 	}
 
-	if actionErr != nil {
-		log.Printf("Failed to perform %s action for job %s (channel %s, user %s): %v", job.TaskType, job.ID, job.ChannelID, job.Email, actionErr)
-		// Optionally, handle retry logic here (e.g., update job status to "FAILED" and retry count)
-	} else {
-		err = db.CompleteJob(job.ID)
-		if err != nil {
-			log.Printf("Failed to mark job %s as complete: %v", job.ID, err)
+	err = db.CompleteJob(job.ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, isEnd := windowEndTasks[job.TaskType]; !isEnd {
+			log.Printf("Job %s was cancelled while running, compensating", job.ID)
+			if err := action.Compensate(ctx, job); err != nil {
+				log.Printf("Failed to compensate %s job %s: %v", job.TaskType, job.ID, err)
+			}
 		}
+		return
 	}
+	if err != nil {
+		log.Printf("Failed to mark job %s as complete: %v", job.ID, err)
+	}
+	go notifyJobResult(job, nil)
 }
 
 // scheduleJob sets a timer to execute a job at its scheduled time
@@ -175,96 +250,260 @@ func recoverAndScheduleJobs() {
 	log.Println("--- Job recovery and scheduling complete ---")
 }
 
-// startAllUserTimers iterates through all user-defined timers and schedules jobs for them.
-// This function needs to be intelligent about not scheduling duplicate jobs for daily timers.
-func startAllUserTimers() {
-	log.Println("--- Starting initial timer evaluation and job generation ---")
-	users, err := db.GetAllUsers()
+// defaultTimezone is used for timers created before the timezone was stored.
+const defaultTimezone = "Asia/Kolkata"
+
+// timerLocation loads the timezone a timer's start time is expressed in.
+func timerLocation(timer db.Timing) (*time.Location, error) {
+	if timer.Timezone == "" {
+		return time.LoadLocation(defaultTimezone)
+	}
+	return time.LoadLocation(timer.Timezone)
+}
+
+// nextWindow computes the next mute window of a timer that has not yet ended,
+// honouring its exceptions. ok is false for paused timers and for one-time
+// timers whose window is skipped or already entirely in the past.
+func nextWindow(timer db.Timing, now time.Time) (muteAt time.Time, unmuteAt time.Time, ok bool, err error) {
+	if timer.Paused {
+		return muteAt, unmuteAt, false, nil
+	}
+	loc, err := timerLocation(timer)
 	if err != nil {
-		log.Printf("Error getting all users for timer evaluation: %v", err)
-		return
+		return muteAt, unmuteAt, false, err
 	}
 
-	for _, user := range users {
-		for _, timer := range user.Timers {
-			loc, err := time.LoadLocation("Asia/Kolkata") // Assuming a default/user-configured timezone
-			if err != nil {
-				log.Printf("Error loading timezone for user %s, timer %s: %v", user.Email, timer.ID, err)
+	now = now.In(loc)
+	days := 1
+	if timer.IsDaily {
+		// Daily timers roll over to the next day that isn't skipped
+		days = 366
+	}
+	for day := 0; day < days; day++ {
+		date := time.Date(now.Year(), now.Month(), now.Day()+day, 0, 0, 0, 0, loc)
+		startTime, duration := timer.StartTime, timer.Duration
+		if ex, found := findException(timer, date); found {
+			if ex.Skip {
 				continue
 			}
+			if ex.StartTime != "" {
+				startTime = ex.StartTime
+			}
+			if ex.Duration > 0 {
+				duration = ex.Duration
+			}
+		}
+
+		parsedStartTime, err := time.Parse("15:04", startTime)
+		if err != nil {
+			return muteAt, unmuteAt, false, err
+		}
+		muteAt = time.Date(date.Year(), date.Month(), date.Day(), parsedStartTime.Hour(), parsedStartTime.Minute(), 0, 0, loc)
+		unmuteAt = muteAt.Add(time.Duration(duration) * time.Minute)
+		if !unmuteAt.Before(now) {
+			return muteAt, unmuteAt, true, nil
+		}
+	}
+	return muteAt, unmuteAt, false, nil
+}
+
+// nextWindowAfter is nextWindow skipping windows that start before
+// runningEnd, the end of a window of the timer that is already running. That
+// window keeps the end jobs it was scheduled with, see cancelFutureJobs, so
+// none are generated for it again.
+func nextWindowAfter(timer db.Timing, now time.Time, runningEnd time.Time) (muteAt time.Time, unmuteAt time.Time, ok bool, err error) {
+	muteAt, unmuteAt, ok, err = nextWindow(timer, now)
+	for ok && err == nil && muteAt.Before(runningEnd) {
+		muteAt, unmuteAt, ok, err = nextWindow(timer, unmuteAt.Add(time.Minute))
+	}
+	return muteAt, unmuteAt, ok, err
+}
+
+// findException returns the exception of a timer for the given local date.
+func findException(timer db.Timing, date time.Time) (db.TimerException, bool) {
+	key := date.Format("2006-01-02")
+	for _, ex := range timer.Exceptions {
+		if ex.Date == key {
+			return ex, true
+		}
+	}
+	return db.TimerException{}, false
+}
+
+// jobID builds the deterministic ID of a job so re-running generation for the
+// same window doesn't insert duplicates.
+func jobID(timerID, channel, taskType string, at time.Time) string {
+	return fmt.Sprintf("%s-%s-%s-%s", timerID, channel, taskType, at.Format("200601021504"))
+}
+
+// legacyJobID is the ID MUTE/UNMUTE jobs had before IDs included the time of
+// day. Jobs stored under it still dedupe their window.
+func legacyJobID(timerID, channel, taskType string, at time.Time) string {
+	return fmt.Sprintf("%s-%s-%s-%s", timerID, channel, taskType, at.Format("20060102"))
+}
+
+// materializeTimerJobs stores and schedules the MUTE/UNMUTE jobs for the next
+// window of a timer. It reports false if there is no upcoming window.
+func materializeTimerJobs(email string, timer db.Timing) (bool, error) {
+	return materializeTimerJobsAfter(email, timer, time.Time{})
+}
+
+// materializeTimerJobsAfter is materializeTimerJobs for the first window
+// starting after runningEnd, see nextWindowAfter.
+func materializeTimerJobsAfter(email string, timer db.Timing, runningEnd time.Time) (bool, error) {
+	if timer.Paused {
+		log.Printf("Skipping paused timer %s for user %s", timer.ID, email)
+		return false, nil
+	}
+	muteAt, unmuteAt, ok, err := nextWindowAfter(withHolidaySkips(email, timer), time.Now(), runningEnd)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		log.Printf("Skipping timer %s for user %s as it has no upcoming window.", timer.ID, email)
+		return false, nil
+	}
+
+	channels, err := timerChannels(email, timer)
+	if err != nil {
+		return false, err
+	}
+	if timerRuns(timer, "MUTE") {
+		scheduleWindowJobs(email, timer.ID, channels, muteAt, unmuteAt)
+	}
+	if timer.Status != nil && timerRuns(timer, "SET_STATUS") {
+		scheduleStatusJobs(email, timer.ID, *timer.Status, muteAt, unmuteAt)
+	}
+	if timer.Digest && timerRuns(timer, "DIGEST") {
+		scheduleDigestJob(email, timer, channels, muteAt, unmuteAt)
+	}
+	return true, nil
+}
 
-			// Parse the start time from the timer
-			parsedStartTime, err := time.Parse("15:04", timer.StartTime)
-			if err != nil {
-				log.Printf("Error parsing timer start time %s for user %s, timer %s: %v", timer.StartTime, user.Email, timer.ID, err)
+// scheduleWindowJobs stores and schedules the MUTE/UNMUTE jobs of one window
+// for every channel.
+func scheduleWindowJobs(email string, timerID string, channels []string, muteAt, unmuteAt time.Time) {
+	for _, channel := range channels {
+		for _, job := range []db.Job{
+			{TaskType: "MUTE", ExecuteAt: muteAt},
+			{TaskType: "UNMUTE", ExecuteAt: unmuteAt},
+		} {
+			job.ID = jobID(timerID, channel, job.TaskType, job.ExecuteAt)
+			job.Email = email
+			job.ChannelID = channel
+			job.Status = "PENDING"
+			job.TimerID = timerID
+			if _, err := db.GetJob(legacyJobID(timerID, channel, job.TaskType, job.ExecuteAt)); err == nil {
+				log.Printf("Keeping legacy %s job of timer %s for %s", job.TaskType, timerID, job.ExecuteAt.Format(time.RFC3339))
 				continue
 			}
+			if err := db.ScheduleJob(&job); err != nil {
+				// Duplicate keys are expected when jobs already exist from a previous run
+				log.Printf("Could not schedule %s job %s (might already exist or DB error): %v", job.TaskType, job.ID, err)
+				continue
+			}
+			log.Printf("Scheduled %s job %s for %s", job.TaskType, job.ID, job.ExecuteAt.Format(time.RFC3339))
+			scheduleJob(job) // Schedule for in-memory execution
+		}
+	}
+}
 
-			now := time.Now().In(loc)
-			// Construct today's mute time
-			todayMuteTime := time.Date(now.Year(), now.Month(), now.Day(), parsedStartTime.Hour(), parsedStartTime.Minute(), 0, 0, loc)
+// windowEndTasks maps the task types ending a window to the ones starting it.
+var windowEndTasks = map[string]string{"UNMUTE": "MUTE", "RESTORE_STATUS": "SET_STATUS"}
+
+// cancelFutureJobs removes the pending jobs of a timer whose window hasn't
+// started yet. UNMUTE and RESTORE_STATUS jobs of a window that is already
+// running are kept so the channels don't stay muted; they are returned to the
+// caller.
+func cancelFutureJobs(timerID string) ([]db.Job, error) {
+	if timerID == "" {
+		// Jobs without a timer, such as webhook deliveries, belong to no
+		// timer; the empty ID would match all of them
+		return nil, nil
+	}
+	pending, err := db.GetPendingJobsForTimer(timerID)
+	if err != nil {
+		return nil, err
+	}
+	cancelled, running := splitFutureJobs(pending)
+	if err := db.RemoveJobs(cancelled); err != nil {
+		return nil, err
+	}
+	log.Printf("Cancelled %d pending jobs for timer %s", len(cancelled), timerID)
+	return running, nil
+}
 
-			// Calculate unmute time based on mute time and duration
-			unmuteTime := todayMuteTime.Add(time.Duration(timer.Duration) * time.Minute)
+// splitFutureJobs splits pending jobs into the IDs of those to cancel and
+// the UNMUTE and RESTORE_STATUS jobs of windows that are already running.
+func splitFutureJobs(pending []db.Job) (cancelled []string, running []db.Job) {
+	// An UNMUTE belongs to a running window if its MUTE has already run,
+	// i.e. there is no pending MUTE of the timer for the channel at or before
+	// it; the same goes for RESTORE_STATUS and SET_STATUS
+	key := func(job db.Job, taskType string) string {
+		return job.TimerID + "/" + job.ChannelID + "/" + taskType
+	}
+	firstStart := make(map[string]time.Time)
+	for _, job := range pending {
+		if first, ok := firstStart[key(job, job.TaskType)]; !ok || job.ExecuteAt.Before(first) {
+			firstStart[key(job, job.TaskType)] = job.ExecuteAt
+		}
+	}
 
-			// Adjust times for daily timers if already passed today
-			if timer.IsDaily && unmuteTime.Before(now) {
-				todayMuteTime = todayMuteTime.Add(24 * time.Hour)
-				unmuteTime = unmuteTime.Add(24 * time.Hour)
-			} else if !timer.IsDaily && unmuteTime.Before(now) {
-				log.Printf("Skipping one-time timer %s for user %s as its unmute time (%s) is already past.", timer.ID, user.Email, unmuteTime.Format(time.RFC3339))
-				continue // Skip one-time timers that are entirely in the past
-			}
+	for _, job := range pending {
+		startTask, isEnd := windowEndTasks[job.TaskType]
+		first, ok := firstStart[key(job, startTask)]
+		if isEnd && (!ok || job.ExecuteAt.Before(first)) {
+			running = append(running, job)
+			continue
+		}
+		cancelled = append(cancelled, job.ID)
+	}
+	return cancelled, running
+}
 
-			// Iterate through channels and schedule jobs
-			for _, channel := range timer.Channels {
-				// Schedule MUTE job
-				muteJobID := fmt.Sprintf("%s-%s-MUTE-%s", timer.ID, channel, todayMuteTime.Format("20060102"))
-				muteJob := db.Job{
-					ID:        muteJobID,
-					Email:     user.Email,
-					TaskType:  "MUTE",
-					ChannelID: channel,
-					ExecuteAt: todayMuteTime,
-					Status:    "PENDING",
-					TimerID:   timer.ID,
-				}
-				if err := db.ScheduleJob(&muteJob); err != nil {
-					// Handle duplicate key error gracefully if jobs already exist (e.g., from a previous run)
-					log.Printf("Could not schedule MUTE job %s (might already exist or DB error): %v", muteJobID, err)
-				} else {
-					log.Printf("Scheduled MUTE job %s for %s", muteJobID, todayMuteTime.Format(time.RFC3339))
-					scheduleJob(muteJob) // Schedule for in-memory execution
-				}
+// startAllUserTimers iterates through all user-defined timers and schedules jobs for them.
+// Job IDs are deterministic, so daily timers don't get duplicate jobs.
+func startAllUserTimers() {
+	log.Println("--- Starting initial timer evaluation and job generation ---")
+	users, err := db.GetAllUsers()
+	if err != nil {
+		log.Printf("Error getting all users for timer evaluation: %v", err)
+		return
+	}
 
-				// Schedule UNMUTE job
-				unmuteJobID := fmt.Sprintf("%s-%s-UNMUTE-%s", timer.ID, channel, unmuteTime.Format("20060102"))
-				unmuteJob := db.Job{
-					ID:        unmuteJobID,
-					Email:     user.Email,
-					TaskType:  "UNMUTE",
-					ChannelID: channel,
-					ExecuteAt: unmuteTime,
-					Status:    "PENDING",
-					TimerID:   timer.ID,
+	for _, user := range users {
+		if user.Disabled {
+			continue
+		}
+		for _, timer := range user.Timers {
+			if timer.Paused && timer.ResumeAt != nil {
+				if timer.ResumeAt.After(time.Now()) {
+					scheduleResume(user.Email, timer)
+					continue
 				}
-				if err := db.ScheduleJob(&unmuteJob); err != nil {
-					log.Printf("Could not schedule UNMUTE job %s (might already exist or DB error): %v", unmuteJobID, err)
-				} else {
-					log.Printf("Scheduled UNMUTE job %s for %s", unmuteJobID, unmuteTime.Format(time.RFC3339))
-					scheduleJob(unmuteJob) // Schedule for in-memory execution
+				if _, err := resumeTimer(user.Email, timer.ID); err != nil {
+					log.Printf("Error resuming timer %s for user %s: %v", timer.ID, user.Email, err)
 				}
+				continue
 			}
+			if _, err := materializeTimerJobs(user.Email, timer); err != nil {
+				log.Printf("Error generating jobs for user %s, timer %s: %v", user.Email, timer.ID, err)
+			}
+		}
+		if err := materializeHolidayJobs(user); err != nil {
+			log.Printf("Error generating holiday jobs for user %s: %v", user.Email, err)
 		}
 	}
+	// Feed windows only reach feedHorizon ahead, so regenerate them on every run
+	syncAllFeeds(true)
 	log.Println("--- Initial timer evaluation and job generation complete ---")
 }
 
 func server() {
 	app := fiber.New()
 	app.Get("/redirect", func(c *fiber.Ctx) error {
-		state := c.Query("client_id") + "and" + c.Query("client_secret") + "and" + c.Query("email")
-		url := `https://accounts.zoho.com/oauth/v2/auth?scope=ZohoCliq.Chats.UPDATE,ZohoCliq.Channels.CREATE,ZohoCliq.Channels.READ,ZohoCliq.Channels.UPDATE,ZohoCliq.Channels.DELETE&client_id=` + c.Query("client_id") + `&state=` + state + `&response_type=code&redirect_uri=` + hostUrl + `/callback&access_type=offline`
+		state := c.Query("client_id") + "and" + c.Query("client_secret")
+		url := `https://accounts.zoho.com/oauth/v2/auth?scope=` + oauthScopes + `&client_id=` + c.Query("client_id") + `&state=` + state + `&response_type=code&redirect_uri=` + hostUrl + `/callback&access_type=offline`
 		return c.Redirect(url)
 	})
 	app.Get("/callback", func(c *fiber.Ctx) error {
@@ -288,146 +527,93 @@ func server() {
 		defer resp.Body.Close()
 
 		dataByte, _ := io.ReadAll(resp.Body)
-		fmt.Println(string(dataByte))
-		var body db.User
-		body.Email = data[2]
-		body.State = state
-		if err := json.Unmarshal(dataByte, &body); err != nil {
-			return c.JSON(fiber.Map{"error": err.Error()})
+		var tokens struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			Error        string `json:"error"`
 		}
-		fmt.Println(body.RefreshToken)
-		if err := body.AddUser(); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.Status(fiber.StatusAccepted).SendString("Success")
-	})
-	app.Get("/gettoken", func(c *fiber.Ctx) error {
-		email := c.Query("email")
-		fmt.Println(email)
-		accessToken, err := refreshAccessToken(email)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		if err := json.Unmarshal(dataByte, &tokens); err != nil {
+			return c.JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"access_token": accessToken})
-	})
-	app.Post("/settimer", func(c *fiber.Ctx) error {
-		email := c.Query("email")
-		timezoneStr := c.Query("timezone") // Renamed to avoid conflict with time.Location
-		starttime := c.Query("start_timer")
-		durationStr := c.Query("duration") // Renamed to avoid conflict with time.Duration
-		isDailyStr := c.Query("isdaily")   // Renamed to avoid conflict with bool
-		channelsBytes := c.Context().QueryArgs().PeekMulti("channels")
-		channels := make([]string, len(channelsBytes))
-		for i, v := range channelsBytes {
-			channels[i] = string(v)
+		if tokens.Error != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": tokens.Error})
 		}
 
-		var timer db.Timing
-		var err error
-
-		timer.ID = uuid.New().String()
-		timer.Channels = channels
-		timer.Duration, err = strconv.Atoi(durationStr)
+		// The user is whoever Zoho says authorized the app
+		email, err := zohoUserEmail(tokens.AccessToken)
 		if err != nil {
-			log.Printf("Error parsing duration: %v", err)
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid duration")
+			log.Printf("Error identifying OAuth user: %v", err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Could not identify Zoho user"})
 		}
-		timer.StartTime = starttime
-		timer.IsDaily, err = strconv.ParseBool(isDailyStr)
-		if err != nil {
-			log.Printf("Error parsing isDaily: %v", err)
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid isDaily value")
-		}
-
-		if err := db.SaveTimer(email, timer); err != nil {
-			log.Printf("Error saving timer to DB: %v", err)
-			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		if existing, err := db.GetUser(email); err == nil && existing.Disabled {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account disabled"})
 		}
-
-		// Calculate job times and schedule them
-		loc, err := time.LoadLocation(timezoneStr)
-		if err != nil {
-			log.Printf("Error loading timezone %s for user %s: %v", timezoneStr, email, err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Invalid timezone")
+		body := db.User{Email: email, State: state, RefreshToken: tokens.RefreshToken}
+		if err := body.AddUser(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		parsedStartTime, err := time.Parse("15:04", timer.StartTime)
+		// Completing OAuth again issues a new key and revokes the old one
+		apiKey, hash, err := newToken()
 		if err != nil {
-			log.Printf("Error parsing timer start time %s for user %s, timer %s: %v", timer.StartTime, email, timer.ID, err)
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid start_timer format")
-		}
-
-		now := time.Now().In(loc)
-		todayMuteTime := time.Date(now.Year(), now.Month(), now.Day(), parsedStartTime.Hour(), parsedStartTime.Minute(), 0, 0, loc)
-		unmuteTime := todayMuteTime.Add(time.Duration(timer.Duration) * time.Minute)
-
-		// If the mute/unmute times are already past for today, and it's a daily timer, schedule for tomorrow.
-		// For one-time timers, if it's past, don't schedule.
-		if unmuteTime.Before(now) {
-			if timer.IsDaily {
-				todayMuteTime = todayMuteTime.Add(24 * time.Hour)
-				unmuteTime = unmuteTime.Add(24 * time.Hour)
-			} else {
-				log.Printf("Not scheduling one-time timer %s for user %s as its time is already past for today.", timer.ID, email)
-				return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "One-time timer not scheduled, time already past."})
-			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
-
-		for _, channel := range timer.Channels {
-			// Schedule MUTE job
-			muteJobID := fmt.Sprintf("%s-%s-MUTE-%s", timer.ID, channel, todayMuteTime.Format("20060102"))
-			muteJob := db.Job{
-				ID:        muteJobID,
-				Email:     email,
-				TaskType:  "MUTE",
-				ChannelID: channel,
-				ExecuteAt: todayMuteTime,
-				Status:    "PENDING",
-				TimerID:   timer.ID,
-			}
-			if err := db.ScheduleJob(&muteJob); err != nil {
-				log.Printf("Error scheduling MUTE job %s: %v", muteJobID, err)
-			} else {
-				scheduleJob(muteJob)
-			}
-
-			// Schedule UNMUTE job
-			unmuteJobID := fmt.Sprintf("%s-%s-UNMUTE-%s", timer.ID, channel, unmuteTime.Format("20060102"))
-			unmuteJob := db.Job{
-				ID:        unmuteJobID,
-				Email:     email,
-				TaskType:  "UNMUTE",
-				ChannelID: channel,
-				ExecuteAt: unmuteTime,
-				Status:    "PENDING",
-				TimerID:   timer.ID,
-			}
-			if err := db.ScheduleJob(&unmuteJob); err != nil {
-				log.Printf("Error scheduling UNMUTE job %s: %v", unmuteJobID, err)
-			} else {
-				scheduleJob(unmuteJob)
-			}
+		if err := db.SetAPIKeyHash(email, hash); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
-
-		return c.Status(fiber.StatusCreated).JSON(timer)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"email": email, "api_key": apiKey})
 	})
+	app.Post("/settimer", requireAuth, createTimerHandler)
+	app.Get("/timers", requireAuth, listTimersHandler)
+	app.Get("/jobs", requireAuth, listJobsHandler)
+	app.Patch("/timers/:id", requireAuth, updateTimerHandler)
+	app.Post("/timers/:id/pause", requireAuth, pauseTimerHandler)
+	app.Post("/timers/:id/resume", requireAuth, resumeTimerHandler)
+	app.Post("/timers/:id/exceptions", requireAuth, addExceptionHandler)
+	app.Delete("/timers/:id/exceptions/:date", requireAuth, removeExceptionHandler)
+	app.Get("/holidays/countries", listCountriesHandler)
+	app.Post("/holidays/calendars", requireAdmin, createHolidayCalendarHandler)
+	app.Get("/holidays", requireAuth, getHolidaysHandler)
+	app.Put("/holidays", requireAuth, putHolidaysHandler)
+	app.Delete("/holidays", requireAuth, deleteHolidaysHandler)
+	app.Post("/feeds", requireAuth, createFeedHandler)
+	app.Get("/feeds", requireAuth, listFeedsHandler)
+	app.Put("/feeds/:id/content", requireAuth, putFeedContentHandler)
+	app.Post("/feeds/:id/sync", requireAuth, syncFeedHandler)
+	app.Delete("/feeds/:id", requireAuth, deleteFeedHandler)
+	app.Post("/calendar/token", requireAuth, calendarTokenHandler)
+	app.Get("/calendar.ics", calendarFeedHandler)
+	// Zoho Cliq extension webhooks
+	registerCliqRoutes(app)
+
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusOK)
 	})
-	app.Post("/stoptimer", func(c *fiber.Ctx) error {
-		email := c.Query("email")
+	app.Post("/stoptimer", requireAuth, func(c *fiber.Ctx) error {
+		email := userEmail(c)
 		id := c.Query("id") // This is the timer.ID
 
-		if err := db.RemoveTimer(email, id); err != nil {
+		if err := stopTimer(email, id); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return sendError(c, fiber.StatusNotFound, "not_found", "Timer not found")
+			}
 			log.Printf("Error removing timer %s for user %s: %v", id, email, err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to stop timer")
+			return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to stop timer")
 		}
-		log.Printf("Successfully stopped timer %s for user %s", id, email)
 		return c.SendStatus(fiber.StatusAccepted)
 	})
+	registerAPIv1(app)
 	app.Listen(":3000")
 }
 
+// untilNextDay returns the time left until a minute past the next midnight.
+// Jobs are only generated a day or two ahead, so startAllUserTimers runs
+// then every day.
+func untilNextDay(now time.Time) time.Duration {
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 1, 0, 0, now.Location())
+	return next.Sub(now)
+}
+
 func main() {
 	db.Connect()
 	// First, recover any jobs that might have been pending from a crash
@@ -435,21 +621,17 @@ func main() {
 	// Then, start/schedule new jobs based on user-defined timers (for the current day)
 	startAllUserTimers()
 
-	// A goroutine to periodically schedule daily timers for the next day
+	// Schedule the jobs of the new day shortly after every midnight
 	go func() {
-		ticker := time.NewTicker(1 * time.Hour) // Check every hour
-		defer ticker.Stop()
-		for range ticker.C {
-			now := time.Now()
-			// For example, if it's past midnight, schedule jobs for the new day
-			// This check prevents running `startAllUserTimers` multiple times right after midnight.
-			if now.Hour() == 0 && now.Minute() >= 0 && now.Minute() < 5 { // Run once shortly after midnight
-				log.Println("It's a new day! Re-evaluating daily timers.")
-				startAllUserTimers()
-			}
+		for {
+			time.Sleep(untilNextDay(time.Now()))
+			log.Println("It's a new day! Re-evaluating daily timers.")
+			startAllUserTimers()
 		}
 	}()
 
+	go refreshFeeds()
+
 	server()
 	defer db.Disconnect()
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+func TestUntilNextDay(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{time.Date(2026, time.March, 2, 23, 59, 30, 0, berlin), 90 * time.Second},
+		{time.Date(2026, time.March, 2, 0, 0, 30, 0, berlin), 24*time.Hour + 30*time.Second},
+		// Right after a run, the next one is a day later
+		{time.Date(2026, time.March, 2, 0, 1, 0, 0, berlin), 24 * time.Hour},
+		// The day the clocks go back has 25 hours
+		{time.Date(2026, time.October, 25, 0, 30, 0, 0, berlin), 24*time.Hour + 31*time.Minute},
+	}
+	for _, tt := range tests {
+		if got := untilNextDay(tt.now); got != tt.want {
+			t.Errorf("untilNextDay(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestNextWindowAfter(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, berlin)
+	}
+	now := at(2, 18, 30)
+	daily := db.Timing{StartTime: "18:00", Duration: 90, IsDaily: true, Timezone: "Europe/Berlin"}
+	longer := daily
+	longer.Duration = 120
+	once := daily
+	once.IsDaily = false
+
+	tests := []struct {
+		name       string
+		timer      db.Timing
+		runningEnd time.Time
+		wantOK     bool
+		start, end time.Time
+	}{
+		{"nothing running", daily, time.Time{}, true, at(2, 18, 0), at(2, 19, 30)},
+		{"running", daily, at(2, 19, 30), true, at(3, 18, 0), at(3, 19, 30)},
+		{"running window extended", longer, at(2, 19, 30), true, at(3, 18, 0), at(3, 20, 0)},
+		{"one-time window running", once, at(2, 19, 30), false, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		start, end, ok, err := nextWindowAfter(tt.timer, now, tt.runningEnd)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok != tt.wantOK || (ok && (!start.Equal(tt.start) || !end.Equal(tt.end))) {
+			t.Errorf("%s: window = %s-%s, %t; want %s-%s, %t", tt.name, start, end, ok, tt.start, tt.end, tt.wantOK)
+		}
+	}
+}
+
+func TestSplitFutureJobs(t *testing.T) {
+	now := time.Now()
+	pending := []db.Job{
+		{ID: "webhook-1-ev-1", Email: "ana@example.com", TaskType: "WEBHOOK", ExecuteAt: now},
+		// Timer a is running: its MUTE has run, the next window is tomorrow
+		{ID: "a-unmute", Email: "ana@example.com", TaskType: "UNMUTE", ChannelID: "c1", TimerID: "a", ExecuteAt: now.Add(time.Hour)},
+		{ID: "a-mute-next", Email: "ana@example.com", TaskType: "MUTE", ChannelID: "c1", TimerID: "a", ExecuteAt: now.Add(24 * time.Hour)},
+		{ID: "a-unmute-next", Email: "ana@example.com", TaskType: "UNMUTE", ChannelID: "c1", TimerID: "a", ExecuteAt: now.Add(25 * time.Hour)},
+		// Timer b mutes the same channel later; its MUTE doesn't make timer
+		// a's UNMUTE a future one
+		{ID: "b-mute", Email: "ana@example.com", TaskType: "MUTE", ChannelID: "c1", TimerID: "b", ExecuteAt: now.Add(30 * time.Minute)},
+		{ID: "b-unmute", Email: "ana@example.com", TaskType: "UNMUTE", ChannelID: "c1", TimerID: "b", ExecuteAt: now.Add(2 * time.Hour)},
+	}
+	cancelled, running := splitFutureJobs(pending)
+
+	wantCancelled := []string{"webhook-1-ev-1", "a-mute-next", "a-unmute-next", "b-mute", "b-unmute"}
+	if !slices.Equal(cancelled, wantCancelled) {
+		t.Errorf("cancelled = %v, want %v", cancelled, wantCancelled)
+	}
+	if len(running) != 1 || running[0].ID != "a-unmute" {
+		t.Errorf("running = %v, want a-unmute", running)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Feeds and webhooks make the server request user-supplied URLs. They only
+// go out through outbound clients, which refuse to connect to loopback,
+// private, link-local and other non-public addresses, so users can't reach
+// services on the server's network.
+
+var errForbiddenAddress = errors.New("address is not publicly routable")
+
+// maxOutboundRedirects bounds the redirects an outbound request follows.
+const maxOutboundRedirects = 5
+
+// publicAddr reports whether an address may be connected to.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	// Carrier-grade NAT and the IPv4 broadcast address aren't covered above
+	if addr.Is4() && (netip.MustParsePrefix("100.64.0.0/10").Contains(addr) || addr == netip.MustParseAddr("255.255.255.255")) {
+		return false
+	}
+	return true
+}
+
+// checkOutboundURL checks that a URL is http or https with a host; where the
+// host resolves to is checked when connecting.
+func checkOutboundURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("url has no host")
+	}
+	return nil
+}
+
+// validateOutboundURL checks a URL submitted by a user, including that its
+// host currently resolves to public addresses only.
+func validateOutboundURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if err := checkOutboundURL(u); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("could not resolve host: %w", err)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return errForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// dialControl rejects connections to non-public addresses. It runs after
+// name resolution for every connection, including those of redirects.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("connecting to %s: %w", addrPort.Addr(), errForbiddenAddress)
+	}
+	return nil
+}
+
+// newOutboundClient returns an HTTP client for user-supplied URLs. It
+// ignores proxy settings so that every connection is checked.
+func newOutboundClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxOutboundRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkOutboundURL(req.URL)
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+// statusChannel stands in for the channel in the IDs of status jobs, which
+// act on the user rather than a chat.
+const statusChannel = "status"
+
+// cliqPresences are the presence codes a timer may set.
+var cliqPresences = map[string]bool{"available": true, "busy": true, "away": true, "invisible": true}
+
+// cliqStatus is a user's Cliq status as read and written by the statuses API.
+type cliqStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func init() {
+	registerJobAction("SET_STATUS", setStatusAction{})
+	registerJobAction("RESTORE_STATUS", restoreStatusAction{})
+}
+
+func getCliqStatus(ctx context.Context, accessToken string) (cliqStatus, error) {
+	var status cliqStatus
+	err := cliqGet(ctx, accessToken, "/statuses/current", &status)
+	return status, err
+}
+
+func setCliqStatus(ctx context.Context, accessToken string, status cliqStatus) error {
+	if err := cliqPost(ctx, accessToken, "/statuses", status); err != nil {
+		return fmt.Errorf("failed to set status: %w", err)
+	}
+	log.Printf("Successfully set Cliq status to %q (%s)", status.Message, status.Code)
+	return nil
+}
+
+// scheduleStatusJobs stores and schedules the SET_STATUS/RESTORE_STATUS jobs
+// of one window. The SET_STATUS job records the status it replaces on the
+// RESTORE_STATUS job when it runs.
+func scheduleStatusJobs(email string, timerID string, status db.TimerStatus, muteAt, unmuteAt time.Time) {
+	restoreID := jobID(timerID, statusChannel, "RESTORE_STATUS", unmuteAt)
+	for _, job := range []db.Job{
+		{
+			TaskType:  "SET_STATUS",
+			ExecuteAt: muteAt,
+			Payload: map[string]string{
+				"code":        status.Presence,
+				"message":     strings.ReplaceAll(status.Message, "{end}", unmuteAt.Format("15:04")),
+				"restore_job": restoreID,
+			},
+		},
+		{TaskType: "RESTORE_STATUS", ExecuteAt: unmuteAt},
+	} {
+		job.ID = jobID(timerID, statusChannel, job.TaskType, job.ExecuteAt)
+		job.Email = email
+		job.Status = "PENDING"
+		job.TimerID = timerID
+		if err := db.ScheduleJob(&job); err != nil {
+			log.Printf("Could not schedule %s job %s (might already exist or DB error): %v", job.TaskType, job.ID, err)
+			continue
+		}
+		log.Printf("Scheduled %s job %s for %s", job.TaskType, job.ID, job.ExecuteAt.Format(time.RFC3339))
+		scheduleJob(job)
+	}
+}
+
+// setStatusAction saves the user's current status on the paired restore job
+// and applies the window's status.
+type setStatusAction struct{}
+
+func (setStatusAction) Execute(ctx context.Context, job db.Job) error {
+	accessToken, err := refreshAccessToken(job.Email)
+	if err != nil {
+		return err
+	}
+	previous, err := getCliqStatus(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if restoreID := job.Payload["restore_job"]; restoreID != "" {
+		payload := map[string]string{"code": previous.Code, "message": previous.Message}
+		if err := db.SetJobPayload(restoreID, payload); err != nil {
+			log.Printf("Could not save previous status on job %s: %v", restoreID, err)
+		}
+	}
+
+	status := cliqStatus{Code: job.Payload["code"], Message: job.Payload["message"]}
+	if status.Code == "" {
+		status.Code = previous.Code
+	}
+	return setCliqStatus(ctx, accessToken, status)
+}
+
+// Compensate puts back the status saved on the restore job.
+func (setStatusAction) Compensate(ctx context.Context, job db.Job) error {
+	restore, err := db.GetJob(job.Payload["restore_job"])
+	if err != nil {
+		restore = db.Job{Email: job.Email}
+	}
+	return restoreStatusAction{}.Execute(ctx, restore)
+}
+
+// restoreStatusAction puts back the status saved by the SET_STATUS job, or
+// makes the user available if none was saved.
+type restoreStatusAction struct{}
+
+func (restoreStatusAction) Execute(ctx context.Context, job db.Job) error {
+	accessToken, err := refreshAccessToken(job.Email)
+	if err != nil {
+		return err
+	}
+	status := cliqStatus{Code: job.Payload["code"], Message: job.Payload["message"]}
+	if status.Code == "" {
+		status.Code = "available"
+	}
+	return setCliqStatus(ctx, accessToken, status)
+}
+
+// Compensate does nothing: the window's status isn't known any more once it
+// has been restored.
+func (restoreStatusAction) Compensate(ctx context.Context, job db.Job) error {
+	return nil
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Roles of team members.
+const (
+	teamManager = "manager"
+	teamMember  = "member"
+)
+
+// errManagedTimer is returned when changing a timer generated from a team
+// policy in a way the policy doesn't allow.
+var errManagedTimer = errors.New("timer is managed by a team policy")
+
+// memberError reports a member whose policy timer couldn't be updated.
+type memberError struct {
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+// policyTimerID is the ID of the timer a policy generates for a member.
+func policyTimerID(policyID string, email string) string {
+	return "policy-" + policyID + "-" + email
+}
+
+func findMember(team db.Team, email string) (int, bool) {
+	for i, member := range team.Members {
+		if strings.EqualFold(member.Email, email) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func findPolicy(team db.Team, policyID string) (int, bool) {
+	for i, policy := range team.Policies {
+		if policy.ID == policyID {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// policyApplies reports whether a member gets a policy's timer.
+func policyApplies(team db.Team, policy db.TeamPolicy, email string) bool {
+	i, ok := findMember(team, email)
+	if !ok || team.Members[i].Pending {
+		return false
+	}
+	return !policy.AllowOptOut || !slices.Contains(team.Members[i].OptedOut, policy.ID)
+}
+
+// syncPolicyMember creates, updates or removes the timer a policy generates
+// for a member. Pauses and exceptions the member added are kept.
+func syncPolicyMember(team db.Team, policy db.TeamPolicy, email string) error {
+	id := policyTimerID(policy.ID, email)
+	existing, err := db.GetTimer(email, id)
+	exists := err == nil
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	if !policyApplies(team, policy, email) {
+		if exists {
+			return removeManagedTimer(email, id)
+		}
+		return nil
+	}
+
+	timer := policy.Timer
+	timer.ID = id
+	timer.Policy = &db.TimerPolicy{TeamID: team.ID, PolicyID: policy.ID, AllowOptOut: policy.AllowOptOut}
+	channels, fields, err := resolveChannelRefs(email, timer.Channels)
+	if err != nil {
+		return fmt.Errorf("error resolving channels: %w", err)
+	}
+	if len(fields) > 0 {
+		return fmt.Errorf("%s %s", fields[0].Field, fields[0].Message)
+	}
+	timer.Channels = channels
+
+	if !exists {
+		_, err := createTimer(email, timer)
+		return err
+	}
+	if policy.AllowOptOut {
+		timer.Paused, timer.PausedAt, timer.ResumeAt = existing.Paused, existing.PausedAt, existing.ResumeAt
+		timer.Exceptions = existing.Exceptions
+	}
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return err
+	}
+	return rescheduleTimer(email, timer)
+}
+
+// removeManagedTimer deletes a policy timer, unmuting the channels of a
+// window it is running.
+func removeManagedTimer(email string, timerID string) error {
+	if err := removeTimer(email, timerID); err != nil {
+		return err
+	}
+	log.Printf("Removed policy timer %s of user %s", timerID, email)
+	return nil
+}
+
+// syncPolicy updates the timer of a policy for every member.
+func syncPolicy(team db.Team, policy db.TeamPolicy) []memberError {
+	errs := []memberError{}
+	for _, member := range team.Members {
+		if err := syncPolicyMember(team, policy, member.Email); err != nil {
+			log.Printf("Error syncing policy %s of team %s for user %s: %v", policy.ID, team.ID, member.Email, err)
+			errs = append(errs, memberError{Email: member.Email, Error: err.Error()})
+		}
+	}
+	return errs
+}
+
+// syncMember updates the timers of every policy of a team for one member.
+func syncMember(team db.Team, email string) error {
+	for _, policy := range team.Policies {
+		if err := syncPolicyMember(team, policy, email); err != nil {
+			return fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+	}
+	return nil
+}
+
+// removeMemberTimers deletes the policy timers of a member leaving a team.
+func removeMemberTimers(team db.Team, email string) error {
+	for _, policy := range team.Policies {
+		err := removeManagedTimer(email, policyTimerID(policy.ID, email))
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	return nil
+}
+
+// teamRequest is the JSON body of POST /teams:
+//
+//	{"name": "Platform"}
+type teamRequest struct {
+	Name string `json:"name"`
+}
+
+func (r teamRequest) validate() []fieldError {
+	if name := strings.TrimSpace(r.Name); name == "" || len([]rune(name)) > 100 {
+		return []fieldError{{Field: "name", Message: "must be 1 to 100 characters"}}
+	}
+	return nil
+}
+
+// memberRequest is the JSON body of PUT /teams/:team/members/:member:
+//
+//	{"role": "member"}
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+func (r memberRequest) validate() []fieldError {
+	if r.Role != teamManager && r.Role != teamMember {
+		return []fieldError{{Field: "role", Message: "must be manager or member"}}
+	}
+	return nil
+}
+
+// policyRequest is the JSON body of POST /teams/:team/policies and
+// PUT /teams/:team/policies/:policy:
+//
+//	{
+//	  "name": "No deploy pings after 19:00",
+//	  "allow_opt_out": false,
+//	  "timer": {"starttime": "19:00", "duration": 720, "isdaily": true,
+//	            "timezone": "Europe/Berlin", "channels": ["#deploys"]}
+//	}
+type policyRequest struct {
+	Name        string       `json:"name"`
+	AllowOptOut bool         `json:"allow_opt_out"`
+	Timer       timerRequest `json:"timer"`
+}
+
+func (r policyRequest) validate() []fieldError {
+	var fields []fieldError
+	if name := strings.TrimSpace(r.Name); name == "" || len([]rune(name)) > 100 {
+		fields = append(fields, fieldError{Field: "name", Message: "must be 1 to 100 characters"})
+	}
+	for _, field := range r.Timer.validate(false) {
+		field.Field = "timer." + field.Field
+		fields = append(fields, field)
+	}
+	if r.Timer.Channels != nil {
+		for i, channel := range *r.Timer.Channels {
+			if strings.HasPrefix(channel, groupPrefix) {
+				fields = append(fields, fieldError{Field: fmt.Sprintf("timer.channels[%d]", i), Message: "channel groups belong to single users and can't be used in policies"})
+			}
+		}
+	}
+	return fields
+}
+
+// loadTeam loads the :team of the route for its members and for users who
+// may manage all teams; others get a 404.
+func loadTeam(c *fiber.Ctx) error {
+	team, err := db.GetTeam(c.Params("team"))
+	if err == nil && !can(c, permManageAllTeams) {
+		if _, ok := findMember(team, userEmail(c)); !ok {
+			err = mongo.ErrNoDocuments
+		}
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Team not found")
+		}
+		log.Printf("Error loading team %s: %v", c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load team")
+	}
+	c.Locals("team", team)
+	return c.Next()
+}
+
+// managesTeam reports whether the authenticated user is a manager of the
+// team or may manage all teams.
+func managesTeam(c *fiber.Ctx, team db.Team) bool {
+	if can(c, permManageAllTeams) {
+		return true
+	}
+	i, ok := findMember(team, userEmail(c))
+	return ok && !team.Members[i].Pending && team.Members[i].Role == teamManager
+}
+
+// requireTeamManager only lets the team's managers through; it runs after
+// loadTeam.
+func requireTeamManager(c *fiber.Ctx) error {
+	if !managesTeam(c, c.Locals("team").(db.Team)) {
+		return sendError(c, fiber.StatusForbidden, "forbidden", "Only team managers can do this")
+	}
+	return c.Next()
+}
+
+// listTeamsHandler lists the teams of the user.
+func listTeamsHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	teams, err := db.GetTeamsForMember(email)
+	if err != nil {
+		log.Printf("Error listing teams for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list teams")
+	}
+	if teams == nil {
+		teams = []db.Team{}
+	}
+	return c.Status(fiber.StatusOK).JSON(teams)
+}
+
+// createTeamHandler creates a team managed by the user.
+func createTeamHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	var req teamRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	team := db.Team{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(req.Name),
+		Members:   []db.TeamMember{{Email: email, Role: teamManager}},
+		Policies:  []db.TeamPolicy{},
+		CreatedAt: time.Now(),
+	}
+	if err := db.CreateTeam(&team); err != nil {
+		log.Printf("Error creating team for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to create team")
+	}
+	log.Printf("User %s created team %s", email, team.ID)
+	return c.Status(fiber.StatusCreated).JSON(team)
+}
+
+func getTeamHandler(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(c.Locals("team").(db.Team))
+}
+
+// deleteTeamHandler deletes a team and the timers its policies generated.
+func deleteTeamHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	for _, member := range team.Members {
+		if err := removeMemberTimers(team, member.Email); err != nil {
+			log.Printf("Error removing policy timers of user %s: %v", member.Email, err)
+			return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete team")
+		}
+	}
+	if err := db.RemoveTeam(team.ID); err != nil {
+		log.Printf("Error deleting team %s: %v", team.ID, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete team")
+	}
+	log.Printf("User %s deleted team %s", userEmail(c), team.ID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// putMemberHandler invites a user to the team or changes their role. The
+// policies only apply once the user accepts the invitation.
+func putMemberHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	var req memberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	user, err := db.GetUser(c.Params("member"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "User not found")
+		}
+		log.Printf("Error loading user %s: %v", c.Params("member"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to add member")
+	}
+
+	i, existing := findMember(team, user.Email)
+	if existing {
+		if isLastManager(team, i) && req.Role != teamManager {
+			return sendError(c, fiber.StatusConflict, "last_manager", "A team needs at least one manager")
+		}
+		team, err = db.SetTeamMemberRole(team.ID, team.Members[i].Email, req.Role)
+	} else {
+		team, err = db.AddTeamMember(team.ID, db.TeamMember{Email: user.Email, Role: req.Role, Pending: true})
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusConflict, "conflict", "The team's members changed meanwhile, please try again")
+		}
+		log.Printf("Error saving team %s: %v", c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to add member")
+	}
+	if !existing {
+		log.Printf("User %s invited %s to team %s", userEmail(c), user.Email, team.ID)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"team": team, "sync_errors": []memberError{}})
+}
+
+// acceptInviteHandler makes the user a member of a team they were invited
+// to and generates their policy timers. Declining is leaving the team.
+func acceptInviteHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	email := userEmail(c)
+	i, ok := findMember(team, email)
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "You are not invited to this team")
+	}
+	if !team.Members[i].Pending {
+		return sendError(c, fiber.StatusConflict, "already_member", "You are already a member of this team")
+	}
+
+	team, err := db.AcceptTeamInvite(team.ID, team.Members[i].Email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusConflict, "already_member", "You are already a member of this team")
+		}
+		log.Printf("Error saving team %s: %v", c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to accept invitation")
+	}
+	errs := []memberError{}
+	if err := syncMember(team, email); err != nil {
+		log.Printf("Error applying policies of team %s to user %s: %v", team.ID, email, err)
+		errs = append(errs, memberError{Email: email, Error: err.Error()})
+	}
+	log.Printf("User %s joined team %s", email, team.ID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"team": team, "sync_errors": errs})
+}
+
+// deleteMemberHandler removes a member and their policy timers. Managers
+// can remove anyone; members can leave and invited users decline.
+func deleteMemberHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	email := userEmail(c)
+	i, ok := findMember(team, c.Params("member"))
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "Member not found")
+	}
+	if !strings.EqualFold(team.Members[i].Email, email) && !managesTeam(c, team) {
+		return sendError(c, fiber.StatusForbidden, "forbidden", "Only team managers can remove other members")
+	}
+	if isLastManager(team, i) {
+		return sendError(c, fiber.StatusConflict, "last_manager", "A team needs at least one manager")
+	}
+
+	member := team.Members[i]
+	team, err := db.RemoveTeamMember(team.ID, member.Email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Member not found")
+		}
+		log.Printf("Error saving team %s: %v", c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to remove member")
+	}
+	if err := removeMemberTimers(team, member.Email); err != nil {
+		log.Printf("Error removing policy timers of user %s: %v", member.Email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to remove member's timers")
+	}
+	log.Printf("User %s removed %s from team %s", email, member.Email, team.ID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// isLastManager reports whether the i-th member is the only manager who
+// accepted their invitation.
+func isLastManager(team db.Team, i int) bool {
+	member := team.Members[i]
+	if member.Pending || member.Role != teamManager {
+		return false
+	}
+	count := 0
+	for _, member := range team.Members {
+		if !member.Pending && member.Role == teamManager {
+			count++
+		}
+	}
+	return count == 1
+}
+
+// createPolicyHandler adds a policy and generates its timer for every member.
+func createPolicyHandler(c *fiber.Ctx) error {
+	return savePolicy(c, db.TeamPolicy{ID: uuid.New().String()}, fiber.StatusCreated)
+}
+
+// putPolicyHandler replaces a policy and updates the members' timers.
+func putPolicyHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	i, ok := findPolicy(team, c.Params("policy"))
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "Policy not found")
+	}
+	return savePolicy(c, team.Policies[i], fiber.StatusOK)
+}
+
+func savePolicy(c *fiber.Ctx, policy db.TeamPolicy, status int) error {
+	team := c.Locals("team").(db.Team)
+	var req policyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+
+	policy.Name = strings.TrimSpace(req.Name)
+	policy.AllowOptOut = req.AllowOptOut
+	policy.Timer = db.Timing{}
+	req.Timer.apply(&policy.Timer)
+	policy.UpdatedAt = time.Now()
+	team, err := db.SaveTeamPolicy(team.ID, policy)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Team not found")
+		}
+		log.Printf("Error saving policy %s of team %s: %v", policy.ID, c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to save policy")
+	}
+	log.Printf("User %s saved policy %s of team %s", userEmail(c), policy.ID, team.ID)
+	return c.Status(status).JSON(fiber.Map{"policy": policy, "sync_errors": syncPolicy(team, policy)})
+}
+
+// deletePolicyHandler deletes a policy and the timers it generated.
+func deletePolicyHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(db.Team)
+	i, ok := findPolicy(team, c.Params("policy"))
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "Policy not found")
+	}
+	policy := team.Policies[i]
+	team, err := db.RemoveTeamPolicy(team.ID, policy.ID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Policy not found")
+		}
+		log.Printf("Error deleting policy %s of team %s: %v", policy.ID, c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete policy")
+	}
+	for _, member := range team.Members {
+		err := removeManagedTimer(member.Email, policyTimerID(policy.ID, member.Email))
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error removing policy timer of user %s: %v", member.Email, err)
+		}
+	}
+	log.Printf("User %s deleted policy %s of team %s", userEmail(c), policy.ID, team.ID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// optOutHandler removes the policy's timer of the user if the policy allows
+// opting out.
+func optOutHandler(c *fiber.Ctx) error {
+	return setOptOut(c, true)
+}
+
+// optInHandler undoes an opt-out and regenerates the user's timer.
+func optInHandler(c *fiber.Ctx) error {
+	return setOptOut(c, false)
+}
+
+func setOptOut(c *fiber.Ctx, optOut bool) error {
+	team := c.Locals("team").(db.Team)
+	email := userEmail(c)
+	p, ok := findPolicy(team, c.Params("policy"))
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "Policy not found")
+	}
+	policy := team.Policies[p]
+	if optOut && !policy.AllowOptOut {
+		return sendError(c, fiber.StatusForbidden, "forbidden", "This policy doesn't allow opting out")
+	}
+
+	i, ok := findMember(team, email)
+	if !ok {
+		return sendError(c, fiber.StatusNotFound, "not_found", "You are not a member of this team")
+	}
+	team, err := db.SetTeamPolicyOptOut(team.ID, team.Members[i].Email, policy.ID, optOut)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "You are not a member of this team")
+		}
+		log.Printf("Error saving team %s: %v", c.Params("team"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to update opt-out")
+	}
+	// Sync the policy as it is now, if it wasn't deleted meanwhile
+	if p, ok := findPolicy(team, policy.ID); ok {
+		policy = team.Policies[p]
+	}
+	if err := syncPolicyMember(team, policy, email); err != nil {
+		log.Printf("Error syncing policy %s for user %s: %v", policy.ID, email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to update policy timer")
+	}
+	if optOut {
+		log.Printf("User %s opted out of policy %s of team %s", email, policy.ID, team.ID)
+	} else {
+		log.Printf("User %s opted back into policy %s of team %s", email, policy.ID, team.ID)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+func TestPolicyApplies(t *testing.T) {
+	team := db.Team{Members: []db.TeamMember{
+		{Email: "ana@example.com", Role: teamManager},
+		{Email: "bob@example.com", Role: teamMember, OptedOut: []string{"p1"}},
+		{Email: "carol@example.com", Role: teamMember, Pending: true},
+	}}
+	strict := db.TeamPolicy{ID: "p1"}
+	optional := db.TeamPolicy{ID: "p1", AllowOptOut: true}
+
+	tests := []struct {
+		name   string
+		policy db.TeamPolicy
+		email  string
+		want   bool
+	}{
+		{"member", strict, "ANA@example.com", true},
+		{"opted out of a strict policy", strict, "bob@example.com", true},
+		{"opted out", optional, "bob@example.com", false},
+		{"invited", strict, "carol@example.com", false},
+		{"not a member", strict, "dave@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := policyApplies(team, tt.policy, tt.email); got != tt.want {
+			t.Errorf("%s: policyApplies = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsLastManager(t *testing.T) {
+	team := db.Team{Members: []db.TeamMember{
+		{Email: "ana@example.com", Role: teamManager},
+		{Email: "bob@example.com", Role: teamManager, Pending: true},
+		{Email: "carol@example.com", Role: teamMember},
+	}}
+	// An invited manager doesn't count until they accept
+	for i, want := range []bool{true, false, false} {
+		if got := isLastManager(team, i); got != want {
+			t.Errorf("isLastManager(%s) = %t, want %t", team.Members[i].Email, got, want)
+		}
+	}
+
+	team.Members[1].Pending = false
+	if isLastManager(team, 0) {
+		t.Error("isLastManager with two managers = true")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+// errNoException is returned when removing an exception for a date the
+// timer has none for.
+var errNoException = errors.New("timer has no exception for this date")
+
+// rescheduleTimer regenerates the future jobs of a timer after it changed.
+// Completed jobs stay as history. A window that is already running ends as
+// scheduled; the change applies from the next window.
+func rescheduleTimer(email string, timer db.Timing) error {
+	running, err := cancelFutureJobs(timer.ID)
+	if err != nil {
+		return err
+	}
+	var runningEnd time.Time
+	for _, job := range running {
+		if job.ExecuteAt.After(runningEnd) {
+			runningEnd = job.ExecuteAt
+		}
+	}
+	_, err = materializeTimerJobsAfter(email, timer, runningEnd)
+	return err
+}
+
+// rescheduleUser regenerates the future holiday and timer jobs of a user,
+// e.g. after their holiday settings changed.
+func rescheduleUser(email string) error {
+	user, err := db.GetUser(email)
+	if err != nil {
+		return err
+	}
+	if _, err := cancelFutureJobs(holidayTimerID(email)); err != nil {
+		return err
+	}
+	if err := materializeHolidayJobs(user); err != nil {
+		return err
+	}
+	for _, timer := range user.Timers {
+		if err := rescheduleTimer(email, timer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// window is a running mute window of a timer and the channels it muted.
+type window struct {
+	TimerID  string
+	MuteAt   time.Time
+	UnmuteAt time.Time
+	Channels []string
+}
+
+// id identifies the window among all windows of its timer.
+func (w window) id() string {
+	return w.TimerID + "-" + w.MuteAt.UTC().Format("200601021504")
+}
+
+// activeWindows returns the user's windows whose MUTE jobs have run and
+// whose UNMUTE jobs are still pending at now. It goes by the jobs rather than
+// the timers so that failed, cancelled and holiday windows are accounted for.
+func activeWindows(email string, now time.Time) ([]window, error) {
+	// Windows last less than a day
+	jobs, _, err := db.FindJobs(db.JobFilter{Email: email, From: now.AddDate(0, 0, -1), To: now.AddDate(0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	byTimer := make(map[string]*window)
+	var order []string
+	for _, job := range jobs { // ordered by execution time
+		w := byTimer[job.TimerID]
+		switch {
+		case job.TaskType == "MUTE" && job.Status == "COMPLETE" && !job.ExecuteAt.After(now):
+			if w == nil || !w.MuteAt.Equal(job.ExecuteAt) {
+				if w == nil {
+					order = append(order, job.TimerID)
+				}
+				w = &window{TimerID: job.TimerID, MuteAt: job.ExecuteAt}
+				byTimer[job.TimerID] = w
+			}
+			w.Channels = append(w.Channels, job.ChannelID)
+		case job.TaskType == "UNMUTE" && job.Status == "COMPLETE" && w != nil && !job.ExecuteAt.Before(w.MuteAt):
+			// The window has ended
+			w.Channels = nil
+		case job.TaskType == "UNMUTE" && job.Status == "PENDING" && job.ExecuteAt.After(now) && w != nil && w.UnmuteAt.IsZero():
+			w.UnmuteAt = job.ExecuteAt
+		}
+	}
+
+	var active []window
+	for _, timerID := range order {
+		if w := byTimer[timerID]; len(w.Channels) > 0 && !w.UnmuteAt.IsZero() {
+			active = append(active, *w)
+		}
+	}
+	return active, nil
+}
+
+// addTimerException stores an exception for one date, replacing any existing
+// exception for the same date, and reschedules the timer.
+func addTimerException(email string, timerID string, ex db.TimerException) (db.Timing, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return timer, err
+	}
+	if timer.Policy != nil && !timer.Policy.AllowOptOut {
+		return timer, errManagedTimer
+	}
+
+	exceptions := []db.TimerException{ex}
+	for _, existing := range timer.Exceptions {
+		if existing.Date != ex.Date {
+			exceptions = append(exceptions, existing)
+		}
+	}
+	timer.Exceptions = exceptions
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return timer, err
+	}
+	return timer, rescheduleTimer(email, timer)
+}
+
+// removeTimerException drops the exception for a date and reschedules the timer.
+func removeTimerException(email string, timerID string, date string) (db.Timing, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return timer, err
+	}
+	if timer.Policy != nil && !timer.Policy.AllowOptOut {
+		return timer, errManagedTimer
+	}
+
+	var exceptions []db.TimerException
+	for _, existing := range timer.Exceptions {
+		if existing.Date != date {
+			exceptions = append(exceptions, existing)
+		}
+	}
+	if len(exceptions) == len(timer.Exceptions) {
+		return timer, errNoException
+	}
+	timer.Exceptions = exceptions
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return timer, err
+	}
+	return timer, rescheduleTimer(email, timer)
+}
+
+// pauseTimer disables a timer without deleting it. Its future jobs are
+// cancelled and channels it currently keeps muted are unmuted right away.
+// A non-nil resumeAt resumes the timer automatically at that time.
+func pauseTimer(email string, timerID string, resumeAt *time.Time) (db.Timing, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return timer, err
+	}
+	if timer.Policy != nil && !timer.Policy.AllowOptOut {
+		return timer, errManagedTimer
+	}
+
+	// Mongo stores milliseconds; truncate so scheduleResume can compare it
+	now := time.Now().Truncate(time.Millisecond)
+	timer.Paused = true
+	timer.PausedAt = &now
+	timer.ResumeAt = resumeAt
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return timer, err
+	}
+
+	running, err := cancelFutureJobs(timer.ID)
+	if err != nil {
+		return timer, err
+	}
+	for _, job := range running {
+		log.Printf("Unmuting channel %s early as timer %s was paused", job.ChannelID, timer.ID)
+		go executeJob(job)
+	}
+
+	if resumeAt != nil {
+		scheduleResume(email, timer)
+	}
+	log.Printf("Paused timer %s for user %s", timer.ID, email)
+	return timer, nil
+}
+
+// resumeTimer re-enables a paused timer and generates its next window.
+func resumeTimer(email string, timerID string) (db.Timing, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return timer, err
+	}
+	if !timer.Paused {
+		return timer, nil
+	}
+
+	timer.Paused = false
+	timer.PausedAt = nil
+	timer.ResumeAt = nil
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return timer, err
+	}
+	if _, err := materializeTimerJobs(email, timer); err != nil {
+		return timer, err
+	}
+	log.Printf("Resumed timer %s for user %s", timer.ID, email)
+	return timer, nil
+}
+
+// scheduleResume sets an in-memory timer to resume a paused timer at its
+// ResumeAt. startAllUserTimers calls it again after a restart.
+func scheduleResume(email string, timer db.Timing) {
+	pausedAt := timer.PausedAt
+	time.AfterFunc(time.Until(*timer.ResumeAt), func() {
+		// Skip if the timer was resumed or paused again in the meantime
+		current, err := db.GetTimer(email, timer.ID)
+		if err != nil || !current.Paused || current.PausedAt == nil || pausedAt == nil || !current.PausedAt.Equal(*pausedAt) {
+			return
+		}
+		if _, err := resumeTimer(email, timer.ID); err != nil {
+			log.Printf("Error resuming timer %s for user %s: %v", timer.ID, email, err)
+		}
+	})
+}
+
+// createTimer stores a new timer and generates its first window. scheduled
+// is false for one-time timers whose start has already passed.
+func createTimer(email string, timer db.Timing) (scheduled bool, err error) {
+	if err := db.SaveTimer(email, timer); err != nil {
+		return false, fmt.Errorf("error saving timer: %w", err)
+	}
+	scheduled, err = materializeTimerJobs(email, timer)
+	if err != nil {
+		return false, fmt.Errorf("error generating jobs: %w", err)
+	}
+	log.Printf("Created timer %s for user %s", timer.ID, email)
+	return scheduled, nil
+}
+
+// updateTimer changes the fields present in a validated request and
+// regenerates the future jobs of the timer.
+func updateTimer(email string, timerID string, req timerRequest) (db.Timing, error) {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return timer, err
+	}
+	if timer.Policy != nil {
+		return timer, errManagedTimer
+	}
+	req.apply(&timer)
+	if err := db.UpdateTimer(email, timer); err != nil {
+		return timer, err
+	}
+	if err := rescheduleTimer(email, timer); err != nil {
+		return timer, fmt.Errorf("error rescheduling timer: %w", err)
+	}
+	log.Printf("Successfully updated timer %s for user %s", timer.ID, email)
+	return timer, nil
+}
+
+// stopTimer deletes a timer, returning mongo.ErrNoDocuments if the user has
+// no such timer. See removeTimer.
+func stopTimer(email string, timerID string) error {
+	timer, err := db.GetTimer(email, timerID)
+	if err != nil {
+		return err
+	}
+	if timer.Policy != nil {
+		return errManagedTimer
+	}
+	if err := removeTimer(email, timerID); err != nil {
+		return err
+	}
+	log.Printf("Successfully stopped timer %s for user %s", timerID, email)
+	return nil
+}
+
+// removeTimer deletes a timer and its future jobs, ending a window it is
+// running right away. Completed and failed jobs stay as history.
+func removeTimer(email string, timerID string) error {
+	running, err := cancelFutureJobs(timerID)
+	if err != nil {
+		return err
+	}
+	for _, job := range running {
+		executeJob(job)
+	}
+	return db.RemoveTimer(email, timerID)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// urgentRateLimit notifications are sent per user per urgentRateWindow;
+	// further matches are only recorded.
+	urgentRateLimit  = 5
+	urgentRateWindow = 15 * time.Minute
+	// maxExcerptLength bounds the message text kept and forwarded.
+	maxExcerptLength = 200
+)
+
+// matchUrgent returns the rule of a timer that a message matches, e.g.
+// "keyword:outage", or "" if none does. Sender rules go first.
+func matchUrgent(rules db.UrgentRules, req cliqIncomingMessage) string {
+	for _, sender := range rules.Senders {
+		if strings.EqualFold(sender, req.Sender.Email) || sender == req.Sender.ID {
+			return "sender:" + sender
+		}
+	}
+	text := strings.ToLower(req.Message.Text)
+	for _, keyword := range rules.Keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			return "keyword:" + keyword
+		}
+	}
+	return ""
+}
+
+// checkUrgent looks for an active window muting the message's chat whose
+// timer has urgent rules the message matches. A match is recorded and, unless
+// the user was notified too often lately, forwarded by the bot.
+func checkUrgent(email string, req cliqIncomingMessage, windows []window) error {
+	for _, w := range windows {
+		if !slices.Contains(w.Channels, req.Chat.ID) {
+			continue
+		}
+		timer, err := db.GetTimer(email, w.TimerID)
+		if err != nil || timer.Urgent == nil {
+			// Holiday windows have no timer and no rules
+			continue
+		}
+		rule := matchUrgent(*timer.Urgent, req)
+		if rule == "" {
+			continue
+		}
+		return notifyUrgent(email, timer.ID, rule, req)
+	}
+	return nil
+}
+
+func notifyUrgent(email string, timerID string, rule string, req cliqIncomingMessage) error {
+	excerpt := []rune(req.Message.Text)
+	if len(excerpt) > maxExcerptLength {
+		excerpt = append(excerpt[:maxExcerptLength], '…')
+	}
+	alert := db.UrgentAlert{
+		ID:         uuid.New().String(),
+		Email:      email,
+		TimerID:    timerID,
+		ChatID:     req.Chat.ID,
+		MessageID:  req.Message.ID,
+		SenderID:   req.Sender.ID,
+		SenderName: strings.TrimSpace(req.Sender.FirstName + " " + req.Sender.LastName),
+		Rule:       rule,
+		Excerpt:    string(excerpt),
+		At:         time.Now(),
+	}
+
+	sent, err := db.CountUrgentNotifications(email, alert.At.Add(-urgentRateWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= urgentRateLimit {
+		alert.Reason = "rate_limited"
+	} else if err := forwardUrgent(email, alert, req.Chat.Title); err != nil {
+		alert.Reason = "send_failed"
+		log.Printf("Error forwarding urgent message to user %s: %v", email, err)
+	} else {
+		alert.Notified = true
+	}
+	log.Printf("Urgent message in %s for user %s matched %s (notified: %t)", alert.ChatID, email, rule, alert.Notified)
+	return db.AddUrgentAlert(alert)
+}
+
+// forwardUrgent sends the user a bot message about an urgent message.
+func forwardUrgent(email string, alert db.UrgentAlert, chatTitle string) error {
+	if chatTitle == "" {
+		chatTitle = alert.ChatID
+	}
+	sender := alert.SenderName
+	if sender == "" {
+		sender = alert.SenderID
+	}
+	text := fmt.Sprintf("Urgent message from %s in %s (matched %s):\n%s", sender, chatTitle, alert.Rule, alert.Excerpt)
+
+	accessToken, err := refreshAccessToken(email)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return sendBotMessage(ctx, accessToken, text)
+}
+
+// listUrgentAlertsHandler returns the latest messages that matched the
+// user's urgent rules.
+func listUrgentAlertsHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		return sendValidationError(c, []fieldError{{Field: "limit", Message: "must be between 1 and 200"}})
+	}
+	alerts, err := db.GetUrgentAlerts(email, int64(limit))
+	if err != nil {
+		log.Printf("Error listing urgent alerts for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list urgent alerts")
+	}
+	if alerts == nil {
+		alerts = []db.UrgentAlert{}
+	}
+	return c.Status(fiber.StatusOK).JSON(alerts)
+}
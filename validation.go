@@ -0,0 +1,320 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiError is the body of every error response of the timer API:
+//
+//	{"error": {"code": "validation_failed", "message": "...",
+//	           "fields": [{"field": "duration", "message": "must be greater than 0"}]}}
+type apiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+// fieldError describes why a single request field was rejected.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func sendError(c *fiber.Ctx, status int, code string, message string) error {
+	return c.Status(status).JSON(fiber.Map{"error": apiError{Code: code, Message: message}})
+}
+
+func sendValidationError(c *fiber.Ctx, fields []fieldError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": apiError{
+		Code:    "validation_failed",
+		Message: "The request has invalid fields",
+		Fields:  fields,
+	}})
+}
+
+// timerRequest is the JSON body of POST /settimer and PATCH /timers/:id.
+// Field names match db.Timing:
+//
+//	{
+//	  "starttime": "18:30",          // HH:MM in timezone, required
+//	  "duration": 90,                // minutes, required, > 0
+//	  "isdaily": true,               // defaults to false
+//	  "timezone": "Asia/Kolkata",    // IANA name, required
+//	  "channels": ["CT_1234"],       // chat IDs, at least one
+//	  "allowlist": false,            // mute everything except channels
+//	  "status": {"message": "Off for the day, back {end}", "presence": "away"},
+//	  "digest": true,                // summary of the muted channels afterwards
+//	  "urgent": {"keywords": ["outage"], "senders": ["oncall@example.com"]},
+//	  "actions": ["SET_STATUS", "RESTORE_STATUS"] // job types to run, defaults to all
+//	}
+//
+// For PATCH every field is optional and only the present ones are changed;
+// an empty status or urgent object removes it, and empty actions run every
+// job type again.
+type timerRequest struct {
+	StartTime *string         `json:"starttime"`
+	Duration  *int            `json:"duration"`
+	IsDaily   *bool           `json:"isdaily"`
+	Timezone  *string         `json:"timezone"`
+	Channels  *[]string       `json:"channels"`
+	Allowlist *bool           `json:"allowlist"`
+	Status    *db.TimerStatus `json:"status"`
+	Digest    *bool           `json:"digest"`
+	Urgent    *db.UrgentRules `json:"urgent"`
+	Actions   *[]string       `json:"actions"`
+}
+
+// parseTimerRequest reads a timerRequest from a JSON body, falling back to
+// the deprecated query parameters (start_timer, duration, isdaily, timezone,
+// repeated channels) when the request has no JSON body.
+func parseTimerRequest(c *fiber.Ctx) (timerRequest, []fieldError) {
+	var req timerRequest
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := c.BodyParser(&req); err != nil {
+			return req, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}}
+		}
+		return req, nil
+	}
+
+	log.Printf("Deprecated query-string timer request to %s", c.Path())
+	c.Set("Deprecation", "true")
+
+	var fields []fieldError
+	if v := c.Query("start_timer"); v != "" {
+		req.StartTime = &v
+	}
+	if v := c.Query("duration"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil {
+			fields = append(fields, fieldError{Field: "duration", Message: "must be an integer number of minutes"})
+		} else {
+			req.Duration = &n
+		}
+	}
+	if v := c.Query("isdaily"); v != "" {
+		if b, err := strconv.ParseBool(v); err != nil {
+			fields = append(fields, fieldError{Field: "isdaily", Message: "must be true or false"})
+		} else {
+			req.IsDaily = &b
+		}
+	}
+	if v := c.Query("timezone"); v != "" {
+		req.Timezone = &v
+	}
+	if channelsBytes := c.Context().QueryArgs().PeekMulti("channels"); len(channelsBytes) > 0 {
+		channels := make([]string, len(channelsBytes))
+		for i, v := range channelsBytes {
+			channels[i] = string(v)
+		}
+		req.Channels = &channels
+	}
+	return req, fields
+}
+
+// validate checks the present fields; unless partial, the required ones
+// must be present too.
+func (r timerRequest) validate(partial bool) []fieldError {
+	var fields []fieldError
+	required := func(field string) {
+		if !partial {
+			fields = append(fields, fieldError{Field: field, Message: "is required"})
+		}
+	}
+
+	if r.StartTime == nil {
+		required("starttime")
+	} else if _, err := time.Parse("15:04", *r.StartTime); err != nil {
+		fields = append(fields, fieldError{Field: "starttime", Message: "must be a time in HH:MM format"})
+	}
+	if r.Duration == nil {
+		required("duration")
+	} else if *r.Duration <= 0 {
+		fields = append(fields, fieldError{Field: "duration", Message: "must be greater than 0"})
+	} else if *r.Duration >= 24*60 {
+		fields = append(fields, fieldError{Field: "duration", Message: "must be shorter than a day"})
+	}
+	if r.Timezone == nil {
+		required("timezone")
+	} else if _, err := time.LoadLocation(*r.Timezone); err != nil || *r.Timezone == "" {
+		fields = append(fields, fieldError{Field: "timezone", Message: "must be an IANA timezone name"})
+	}
+	// Timers that don't mute need no channels
+	allowlist := r.Allowlist != nil && *r.Allowlist
+	mutes := r.Actions == nil || len(*r.Actions) == 0 || slices.Contains(*r.Actions, "MUTE")
+	if r.Channels == nil {
+		if !allowlist && mutes {
+			required("channels")
+		}
+	} else if len(*r.Channels) == 0 && !allowlist && mutes {
+		fields = append(fields, fieldError{Field: "channels", Message: "must contain at least one channel"})
+	} else {
+		for i, channel := range *r.Channels {
+			if strings.TrimSpace(channel) == "" {
+				fields = append(fields, fieldError{Field: "channels[" + strconv.Itoa(i) + "]", Message: "must not be empty"})
+			}
+		}
+	}
+	if r.Status != nil {
+		if r.Status.Presence != "" && !cliqPresences[r.Status.Presence] {
+			fields = append(fields, fieldError{Field: "status.presence", Message: "must be available, busy, away or invisible"})
+		}
+		if len([]rune(r.Status.Message)) > 100 {
+			fields = append(fields, fieldError{Field: "status.message", Message: "must be at most 100 characters"})
+		}
+	}
+	if r.Urgent != nil {
+		fields = append(fields, validateUrgentList("urgent.keywords", r.Urgent.Keywords, 50)...)
+		fields = append(fields, validateUrgentList("urgent.senders", r.Urgent.Senders, 254)...)
+	}
+
+	if r.Actions != nil {
+		fields = append(fields, validateActions(*r.Actions)...)
+		// New timers must also have the settings the job types act on
+		if !partial {
+			var probe db.Timing
+			r.apply(&probe)
+			produced := windowTaskTypes(probe)
+			for i, taskType := range *r.Actions {
+				if slices.Contains(timerTaskTypes, taskType) && !slices.Contains(produced, taskType) {
+					fields = append(fields, fieldError{Field: "actions[" + strconv.Itoa(i) + "]", Message: "needs the timer setting it acts on, e.g. status for SET_STATUS"})
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// apply copies the present fields onto a timer.
+func (r timerRequest) apply(timer *db.Timing) {
+	if r.StartTime != nil {
+		timer.StartTime = *r.StartTime
+	}
+	if r.Duration != nil {
+		timer.Duration = *r.Duration
+	}
+	if r.IsDaily != nil {
+		timer.IsDaily = *r.IsDaily
+	}
+	if r.Timezone != nil {
+		timer.Timezone = *r.Timezone
+	}
+	if r.Channels != nil {
+		timer.Channels = *r.Channels
+	}
+	if r.Allowlist != nil {
+		timer.Allowlist = *r.Allowlist
+	}
+	if r.Status != nil {
+		timer.Status = nil
+		if *r.Status != (db.TimerStatus{}) {
+			status := *r.Status
+			timer.Status = &status
+		}
+	}
+	if r.Digest != nil {
+		timer.Digest = *r.Digest
+	}
+	if r.Actions != nil {
+		timer.Actions = *r.Actions
+	}
+	if r.Urgent != nil {
+		timer.Urgent = nil
+		if len(r.Urgent.Keywords) > 0 || len(r.Urgent.Senders) > 0 {
+			urgent := *r.Urgent
+			timer.Urgent = &urgent
+		}
+	}
+}
+
+// validateUrgentList checks the keywords or senders of urgent rules.
+func validateUrgentList(field string, values []string, maxLength int) []fieldError {
+	if len(values) > 20 {
+		return []fieldError{{Field: field, Message: "must contain at most 20 entries"}}
+	}
+	var fields []fieldError
+	for i, value := range values {
+		switch {
+		case strings.TrimSpace(value) == "":
+			fields = append(fields, fieldError{Field: field + "[" + strconv.Itoa(i) + "]", Message: "must not be empty"})
+		case len([]rune(value)) > maxLength:
+			fields = append(fields, fieldError{Field: field + "[" + strconv.Itoa(i) + "]", Message: "must be at most " + strconv.Itoa(maxLength) + " characters"})
+		}
+	}
+	return fields
+}
+
+// exceptionRequest is the JSON body of POST /timers/:id/exceptions:
+//
+//	{"date": "2026-12-31", "skip": true}
+//	{"date": "2026-12-31", "starttime": "21:00", "duration": 60}
+type exceptionRequest struct {
+	Date      string `json:"date"`
+	Skip      bool   `json:"skip"`
+	StartTime string `json:"starttime"`
+	Duration  int    `json:"duration"`
+}
+
+// parseExceptionRequest reads an exceptionRequest from a JSON body or the
+// deprecated query parameters (date, skip, start_timer, duration).
+func parseExceptionRequest(c *fiber.Ctx) (exceptionRequest, []fieldError) {
+	var req exceptionRequest
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		if err := c.BodyParser(&req); err != nil {
+			return req, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}}
+		}
+		return req, nil
+	}
+
+	c.Set("Deprecation", "true")
+	var fields []fieldError
+	req.Date = c.Query("date")
+	req.StartTime = c.Query("start_timer")
+	if v := c.Query("skip"); v != "" {
+		var err error
+		if req.Skip, err = strconv.ParseBool(v); err != nil {
+			fields = append(fields, fieldError{Field: "skip", Message: "must be true or false"})
+		}
+	}
+	if v := c.Query("duration"); v != "" {
+		var err error
+		if req.Duration, err = strconv.Atoi(v); err != nil {
+			fields = append(fields, fieldError{Field: "duration", Message: "must be an integer number of minutes"})
+		}
+	}
+	return req, fields
+}
+
+func (r exceptionRequest) validate() []fieldError {
+	var fields []fieldError
+	if _, err := time.Parse("2006-01-02", r.Date); err != nil {
+		fields = append(fields, fieldError{Field: "date", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	if r.Skip {
+		return fields
+	}
+	if r.StartTime != "" {
+		if _, err := time.Parse("15:04", r.StartTime); err != nil {
+			fields = append(fields, fieldError{Field: "starttime", Message: "must be a time in HH:MM format"})
+		}
+	}
+	if r.Duration < 0 || r.Duration >= 24*60 {
+		fields = append(fields, fieldError{Field: "duration", Message: "must be between 1 and 1439 minutes"})
+	}
+	if r.StartTime == "" && r.Duration == 0 {
+		fields = append(fields, fieldError{Field: "skip", Message: "an exception needs skip, starttime or duration"})
+	}
+	return fields
+}
+
+func (r exceptionRequest) exception() db.TimerException {
+	if r.Skip {
+		return db.TimerException{Date: r.Date, Skip: true}
+	}
+	return db.TimerException{Date: r.Date, StartTime: r.StartTime, Duration: r.Duration}
+}
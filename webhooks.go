@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Events sent to webhooks.
+const (
+	eventWindowStarted = "window.started"
+	eventWindowEnded   = "window.ended"
+	eventJobFailed     = "job.failed"
+)
+
+var webhookEvents = map[string]bool{eventWindowStarted: true, eventWindowEnded: true, eventJobFailed: true}
+
+// maxWebhooks caps the subscriptions of a user.
+const maxWebhooks = 10
+
+// webhookRetryDelays are the waits before each delivery attempt; a delivery
+// is retried until it gets a 2xx response or the delays run out.
+var webhookRetryDelays = []time.Duration{0, 30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// webhookClient only connects to public addresses, like feedClient.
+var webhookClient = newOutboundClient(10 * time.Second)
+
+func init() {
+	registerJobAction("WEBHOOK", webhookAction{})
+}
+
+// webhookEvent is the JSON body POSTed to webhooks. It is signed with the
+// webhook's secret: the X-AfterWork-Signature header holds
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where
+// timestamp is the X-AfterWork-Timestamp header in Unix seconds.
+type webhookEvent struct {
+	ID         string         `json:"id"`
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Data       map[string]any `json:"data"`
+}
+
+// signWebhook returns the signature of a webhook body sent at timestamp.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyJobResult emits the webhook events of an executed job: job.failed if
+// it failed, otherwise window.started or window.ended for the first job of
+// its window to complete.
+func notifyJobResult(job db.Job, jobErr error) {
+	// Deliveries report their failures in the delivery log instead
+	if job.TaskType == "WEBHOOK" {
+		return
+	}
+	data := map[string]any{
+		"timer_id":  job.TimerID,
+		"job_id":    job.ID,
+		"task_type": job.TaskType,
+		"at":        job.ExecuteAt,
+	}
+	if job.ChannelID != "" {
+		data["channel_id"] = job.ChannelID
+	}
+	if jobErr != nil {
+		data["error"] = jobErr.Error()
+		emitEvent(job.Email, eventJobFailed, uuid.New().String(), data)
+		return
+	}
+
+	event := eventWindowStarted
+	if _, isEnd := windowEndTasks[job.TaskType]; isEnd {
+		event = eventWindowEnded
+	} else if !isWindowStartTask(job.TaskType) {
+		return
+	}
+	delete(data, "job_id")
+	delete(data, "task_type")
+	delete(data, "channel_id")
+	// One event per window, whichever of its jobs completes first
+	eventID := fmt.Sprintf("%s-%s-%s", event, job.TimerID, job.ExecuteAt.UTC().Format("20060102T1504"))
+	emitEvent(job.Email, event, eventID, data)
+}
+
+// isWindowStartTask reports whether a job type starts a window.
+func isWindowStartTask(taskType string) bool {
+	for _, start := range windowEndTasks {
+		if start == taskType {
+			return true
+		}
+	}
+	return false
+}
+
+// emitEvent delivers an event to the user's webhooks subscribed to it.
+// Events already emitted under the same ID are dropped.
+func emitEvent(email string, event string, eventID string, data map[string]any) {
+	webhooks, err := db.GetWebhooks(email)
+	if err != nil {
+		log.Printf("Error loading webhooks for user %s: %v", email, err)
+		return
+	}
+	var subscribed []db.Webhook
+	for _, webhook := range webhooks {
+		if subscribes(webhook, event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+	first, err := db.RecordEvent(eventID, event)
+	if err != nil {
+		log.Printf("Error recording event %s: %v", eventID, err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	body, err := json.Marshal(webhookEvent{ID: eventID, Event: event, OccurredAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Error encoding event %s: %v", eventID, err)
+		return
+	}
+	for _, webhook := range subscribed {
+		deliverWebhook(webhook, eventID, event, body, 0)
+	}
+}
+
+func subscribes(webhook db.Webhook, event string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhook stores and schedules delivery attempt number attempt (from
+// 0) of an event as a WEBHOOK job, so pending deliveries survive restarts.
+func deliverWebhook(webhook db.Webhook, eventID string, event string, body []byte, attempt int) {
+	job := db.Job{
+		ID:        fmt.Sprintf("webhook-%s-%s-%d", webhook.ID, eventID, attempt+1),
+		Email:     webhook.Email,
+		TaskType:  "WEBHOOK",
+		ExecuteAt: time.Now().Add(webhookRetryDelays[attempt]),
+		Status:    "PENDING",
+		Payload: map[string]string{
+			"webhook_id": webhook.ID,
+			"event_id":   eventID,
+			"event":      event,
+			"body":       string(body),
+			"attempt":    strconv.Itoa(attempt),
+		},
+	}
+	if err := db.ScheduleJob(&job); err != nil {
+		log.Printf("Could not schedule delivery %d of event %s to webhook %s: %v", attempt+1, eventID, webhook.ID, err)
+		return
+	}
+	scheduleJob(job)
+}
+
+// webhookAction makes one delivery attempt of an event and schedules the
+// next one if it fails. Failed attempts are recorded in the delivery log
+// rather than failing the job.
+type webhookAction struct{}
+
+func (webhookAction) Execute(ctx context.Context, job db.Job) error {
+	webhook, err := db.GetWebhook(job.Email, job.Payload["webhook_id"])
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Dropping delivery job %s: webhook was removed", job.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	attempt, _ := strconv.Atoi(job.Payload["attempt"])
+	eventID, event, body := job.Payload["event_id"], job.Payload["event"], []byte(job.Payload["body"])
+
+	delivery := db.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: webhook.ID,
+		Email:     webhook.Email,
+		EventID:   eventID,
+		Event:     event,
+		Attempt:   attempt + 1,
+		At:        time.Now(),
+	}
+	delivery.StatusCode, delivery.Error = postWebhook(ctx, webhook, eventID, event, body)
+	delivery.Success = delivery.Error == ""
+	if err := db.AddWebhookDelivery(delivery); err != nil {
+		log.Printf("Error logging delivery of event %s to webhook %s: %v", eventID, webhook.ID, err)
+	}
+	if delivery.Success {
+		return nil
+	}
+	log.Printf("Delivery %d of event %s to webhook %s failed: %s", attempt+1, eventID, webhook.ID, delivery.Error)
+	if attempt+1 < len(webhookRetryDelays) {
+		deliverWebhook(webhook, eventID, event, body, attempt+1)
+	}
+	return nil
+}
+
+// Compensate does nothing, as a delivered event can't be taken back.
+func (webhookAction) Compensate(ctx context.Context, job db.Job) error {
+	return nil
+}
+
+// postWebhook sends a signed event and returns the response status and a
+// failure message, empty on success.
+func postWebhook(ctx context.Context, webhook db.Webhook, eventID string, event string, body []byte) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AfterWork-Buddy-Webhooks")
+	req.Header.Set("X-AfterWork-Event", event)
+	req.Header.Set("X-AfterWork-Delivery", eventID)
+	req.Header.Set("X-AfterWork-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-AfterWork-Signature", signWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, "unexpected status " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// webhookRequest is the JSON body of POST /webhooks:
+//
+//	{"url": "https://example.com/hooks/afterwork", "events": ["window.started"]}
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (r webhookRequest) validate() []fieldError {
+	var fields []fieldError
+	if err := validateOutboundURL(r.URL); err != nil {
+		fields = append(fields, fieldError{Field: "url", Message: "must be a public http or https URL"})
+	}
+	for i, event := range r.Events {
+		if !webhookEvents[event] {
+			fields = append(fields, fieldError{Field: "events[" + strconv.Itoa(i) + "]", Message: "must be one of window.started, window.ended, job.failed"})
+		}
+	}
+	return fields
+}
+
+// listWebhooksHandler lists the webhooks of the user; secrets are not shown.
+func listWebhooksHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	webhooks, err := db.GetWebhooks(email)
+	if err != nil {
+		log.Printf("Error listing webhooks for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list webhooks")
+	}
+	if webhooks == nil {
+		webhooks = []db.Webhook{}
+	}
+	return c.Status(fiber.StatusOK).JSON(webhooks)
+}
+
+// createWebhookHandler subscribes a URL to events. The signing secret is only
+// returned in this response.
+func createWebhookHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	var req webhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendValidationError(c, []fieldError{{Field: "body", Message: "must be a valid JSON object: " + err.Error()}})
+	}
+	if fields := req.validate(); len(fields) > 0 {
+		return sendValidationError(c, fields)
+	}
+	existing, err := db.GetWebhooks(email)
+	if err != nil {
+		log.Printf("Error listing webhooks for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to create webhook")
+	}
+	if len(existing) >= maxWebhooks {
+		return sendValidationError(c, []fieldError{{Field: "url", Message: "at most " + strconv.Itoa(maxWebhooks) + " webhooks are allowed"}})
+	}
+
+	secret, _, err := newToken()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to create webhook")
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	webhook := db.Webhook{
+		ID:        uuid.New().String(),
+		Email:     email,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		CreatedAt: time.Now(),
+	}
+	if err := db.CreateWebhook(&webhook); err != nil {
+		log.Printf("Error saving webhook for user %s: %v", email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to create webhook")
+	}
+	log.Printf("Created webhook %s for user %s", webhook.ID, email)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         webhook.ID,
+		"url":        webhook.URL,
+		"events":     webhook.Events,
+		"created_at": webhook.CreatedAt,
+		"secret":     secret,
+	})
+}
+
+// deleteWebhookHandler removes a webhook; its pending deliveries are dropped.
+func deleteWebhookHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	if err := db.RemoveWebhook(email, c.Params("id")); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Webhook not found")
+		}
+		log.Printf("Error deleting webhook %s for user %s: %v", c.Params("id"), email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to delete webhook")
+	}
+	log.Printf("Deleted webhook %s for user %s", c.Params("id"), email)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// listDeliveriesHandler returns the latest delivery attempts of a webhook.
+func listDeliveriesHandler(c *fiber.Ctx) error {
+	email := userEmail(c)
+	if _, err := db.GetWebhook(email, c.Params("id")); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sendError(c, fiber.StatusNotFound, "not_found", "Webhook not found")
+		}
+		log.Printf("Error loading webhook %s for user %s: %v", c.Params("id"), email, err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load deliveries")
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		return sendValidationError(c, []fieldError{{Field: "limit", Message: "must be between 1 and 200"}})
+	}
+	deliveries, err := db.GetWebhookDeliveries(email, c.Params("id"), int64(limit))
+	if err != nil {
+		log.Printf("Error listing deliveries of webhook %s: %v", c.Params("id"), err)
+		return sendError(c, fiber.StatusInternalServerError, "internal_error", "Failed to load deliveries")
+	}
+	if deliveries == nil {
+		deliveries = []db.WebhookDelivery{}
+	}
+	return c.Status(fiber.StatusOK).JSON(deliveries)
+}
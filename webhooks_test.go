@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/EthicalGopher/AfterWork_Buddy/db"
+)
+
+func TestWebhookRequestValidate(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"ftp://example.com/hook",
+		"http://localhost:3000/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://192.168.0.10/hook",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		if fields := (webhookRequest{URL: raw}).validate(); len(fields) != 1 || fields[0].Field != "url" {
+			t.Errorf("validate(%q) = %v, want a url error", raw, fields)
+		}
+	}
+	if fields := (webhookRequest{URL: "http://8.8.8.8/hook", Events: []string{"window.started", "timer.created"}}).validate(); len(fields) != 1 || fields[0].Field != "events[1]" {
+		t.Errorf("validate(unknown event) = %v", fields)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got, gotBody = r, string(body)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "nope", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	webhook := db.Webhook{ID: "w1", URL: srv.URL + "/hook", Secret: "secret"}
+	body := []byte(`{"id":"e1","event":"window.started"}`)
+
+	// The outbound client refuses the local server
+	if status, failure := postWebhook(t.Context(), webhook, "e1", eventWindowStarted, body); status != 0 || !strings.Contains(failure, errForbiddenAddress.Error()) {
+		t.Errorf("posting to a loopback address = %d %q, want it refused", status, failure)
+	}
+
+	previous := webhookClient
+	webhookClient = srv.Client()
+	t.Cleanup(func() { webhookClient = previous })
+
+	status, failure := postWebhook(t.Context(), webhook, "e1", eventWindowStarted, body)
+	if status != http.StatusOK || failure != "" {
+		t.Fatalf("postWebhook = %d %q", status, failure)
+	}
+	timestamp, err := strconv.ParseInt(got.Header.Get("X-AfterWork-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get("X-AfterWork-Signature") != signWebhook("secret", timestamp, body) || gotBody != string(body) {
+		t.Errorf("delivery isn't signed: %v %s", got.Header, gotBody)
+	}
+	if got.Header.Get("X-AfterWork-Event") != eventWindowStarted || got.Header.Get("X-AfterWork-Delivery") != "e1" {
+		t.Errorf("headers = %v", got.Header)
+	}
+
+	webhook.URL = srv.URL + "/fail"
+	if status, failure := postWebhook(t.Context(), webhook, "e1", eventWindowStarted, body); status != http.StatusServiceUnavailable || failure == "" {
+		t.Errorf("failed delivery = %d %q", status, failure)
+	}
+}